@@ -0,0 +1,197 @@
+package tinybtree
+
+import "sync"
+
+// nodePool holds released nodes for trees that use the node pool.
+var nodePool = sync.Pool{
+	New: func() interface{} {
+		return new(node)
+	},
+}
+
+// childrenPool holds the child arrays of released branch nodes.
+var childrenPool = sync.Pool{
+	New: func() interface{} {
+		return new([maxItems + 1]*node)
+	},
+}
+
+func (tr *BTree) newNode() *node {
+	var n *node
+	if len(tr.reserve) > 0 {
+		n = tr.reserve[len(tr.reserve)-1]
+		tr.reserve[len(tr.reserve)-1] = nil
+		tr.reserve = tr.reserve[:len(tr.reserve)-1]
+	} else if tr.pooled {
+		n = nodePool.Get().(*node)
+	} else {
+		n = new(node)
+	}
+	n.isoid = tr.isoid
+	return n
+}
+
+// newChildren returns an empty child array for a branch node.
+func (tr *BTree) newChildren() *[maxItems + 1]*node {
+	if len(tr.kids) > 0 {
+		c := tr.kids[len(tr.kids)-1]
+		tr.kids[len(tr.kids)-1] = nil
+		tr.kids = tr.kids[:len(tr.kids)-1]
+		return c
+	}
+	if tr.pooled {
+		return childrenPool.Get().(*[maxItems + 1]*node)
+	}
+	return new([maxItems + 1]*node)
+}
+
+// newBranch returns a new node with room for children.
+func (tr *BTree) newBranch() *node {
+	n := tr.newNode()
+	n.children = tr.newChildren()
+	return n
+}
+
+// cow returns n if it's owned by the tree, otherwise a copy of n that is.
+// Shared nodes belong to snapshots and must not be modified.
+func (tr *BTree) cow(n *node) *node {
+	if n.isoid == tr.isoid {
+		return n
+	}
+	n2 := tr.newNode()
+	*n2 = *n
+	n2.isoid = tr.isoid
+	if n.children != nil {
+		n2.children = tr.newChildren()
+		*n2.children = *n.children
+	}
+	return n2
+}
+
+func (tr *BTree) freeNode(n *node) {
+	if n.isoid != tr.isoid {
+		// shared with a snapshot
+		return
+	}
+	children := n.children
+	if tr.reserved {
+		*n = node{}
+		tr.reserve = append(tr.reserve, n)
+	} else if tr.pooled {
+		*n = node{}
+		nodePool.Put(n)
+	} else {
+		return
+	}
+	// the child array is kept for the next branch
+	if children != nil {
+		*children = [maxItems + 1]*node{}
+		if tr.reserved {
+			tr.kids = append(tr.kids, children)
+		} else {
+			childrenPool.Put(children)
+		}
+	}
+}
+
+// UseNodePool makes the tree allocate nodes from, and release nodes to, a
+// sync.Pool shared by all trees that use it. This reduces GC pressure for
+// programs that churn through many short-lived trees, especially together
+// with Clear(true). A tree with a reserve still prefers its reserve.
+func (tr *BTree) UseNodePool(use bool) {
+	tr.pooled = use
+}
+
+// Clear removes all keys from the tree. When releaseNodes is true every
+// node is handed back to the reserve or the node pool for reuse, in which
+// case no iterator over the tree may be used afterwards. With an OnDelete
+// hook every key is reported first, which makes Clear O(n).
+func (tr *BTree) Clear(releaseNodes bool) {
+	if tr.onDelete != nil {
+		tr.Scan(func(key string) bool {
+			tr.onDelete(key)
+			return true
+		})
+	}
+	tr.clear(releaseNodes)
+}
+
+// clear is Clear without the OnDelete hook, for whole tree rebuilds.
+func (tr *BTree) clear(releaseNodes bool) {
+	if releaseNodes && tr.root != nil && (tr.reserved || tr.pooled) {
+		tr.root.release(tr, tr.height)
+	}
+	tr.root, tr.height, tr.length = nil, 0, 0
+	tr.gen++
+}
+
+// own stamps the nodes of a subtree that no other tree shares with isoid.
+func (n *node) own(isoid uint64, height int) {
+	n.isoid = isoid
+	if height > 0 {
+		for i := 0; i <= n.numItems; i++ {
+			n.children[i].own(isoid, height-1)
+		}
+	}
+}
+
+func (n *node) release(tr *BTree, height int) {
+	if n.isoid != tr.isoid {
+		return
+	}
+	if height > 0 {
+		for i := 0; i <= n.numItems; i++ {
+			n.children[i].release(tr, height-1)
+		}
+	}
+	tr.freeNode(n)
+}
+
+// Reserve preallocates nodes so that the tree holds at least n unused nodes
+// in reserve, along with child arrays for the branch nodes among them.
+// From then on nodes are taken from the reserve, and nodes released by
+// deletes are returned to it. Use TrySet to insert without allocating
+// beyond the reserve.
+func (tr *BTree) Reserve(n int) {
+	tr.reserved = true
+	if n > len(tr.reserve) {
+		nodes := make([]node, n-len(tr.reserve))
+		for i := range nodes {
+			tr.reserve = append(tr.reserve, &nodes[i])
+		}
+	}
+	// every branch but the root has more than minItems children, and each
+	// level may hold one more partly filled branch
+	if k := n/minItems + maxHeight; k > len(tr.kids) {
+		kids := make([][maxItems + 1]*node, k-len(tr.kids))
+		for i := range kids {
+			tr.kids = append(tr.kids, &kids[i])
+		}
+	}
+}
+
+// Reserved returns the number of unused nodes held in reserve.
+func (tr *BTree) Reserved() int {
+	return len(tr.reserve)
+}
+
+// TrySet is like Set, but on a tree with a reserve it returns ErrFull and
+// leaves the tree unchanged when the insert might need more nodes than
+// remain in the reserve. Replacing a key that's already in the tree never
+// takes a node, even from a tree that shares its nodes with a snapshot.
+func (tr *BTree) TrySet(key string) (prev string, replaced bool, err error) {
+	// a split on every level plus a new root, of which all but the leaf
+	// are branches
+	need, kids := tr.height+2, tr.height+1
+	if tr.isoid != 0 {
+		// the path may also be copied away from a snapshot
+		need += tr.height + 1
+		kids += tr.height
+	}
+	if tr.reserved && (len(tr.reserve) < need || len(tr.kids) < kids) &&
+		!tr.Get(key) {
+		return "", false, ErrFull
+	}
+	prev, replaced = tr.Set(key)
+	return prev, replaced, nil
+}
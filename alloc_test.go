@@ -0,0 +1,182 @@
+package tinybtree
+
+import (
+	"bytes"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+func TestReserve(t *testing.T) {
+	var tr BTree
+	tr.Reserve(10)
+	if tr.Reserved() != 10 {
+		t.Fatalf("expected 10, got %v", tr.Reserved())
+	}
+	keys := randKeys(100_000)
+	var n int
+	for _, key := range keys {
+		_, _, err := tr.TrySet(key)
+		if err == ErrFull {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n == 0 || n == len(keys) {
+		t.Fatalf("expected reserve to run out, inserted %v", n)
+	}
+	if tr.Len() != n {
+		t.Fatalf("expected %v, got %v", n, tr.Len())
+	}
+	// existing keys still report replaced
+	prev, replaced, err := tr.TrySet(keys[0])
+	if prev != keys[0] || !replaced || err != nil {
+		t.Fatalf("expected '%v'/true/nil, got '%v'/%v/%v",
+			keys[0], prev, replaced, err)
+	}
+	// deletes return nodes to the reserve
+	for _, key := range keys[:n] {
+		tr.Delete(key)
+	}
+	if tr.Reserved() < 10 {
+		t.Fatalf("expected at least 10, got %v", tr.Reserved())
+	}
+	for _, key := range keys[:n] {
+		if _, _, err := tr.TrySet(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReserveNoAlloc(t *testing.T) {
+	var tr BTree
+	tr.Reserve(1000)
+	keys := randKeys(400_000)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var n int
+	for _, key := range keys {
+		if _, _, err := tr.TrySet(key); err != nil {
+			break
+		}
+		n++
+	}
+	// churn returns nodes and child arrays to the reserve
+	for _, key := range keys[:n/2] {
+		tr.Delete(key)
+	}
+	for _, key := range keys[:n/2] {
+		if _, _, err := tr.TrySet(key); err != nil {
+			break
+		}
+	}
+	runtime.ReadMemStats(&after)
+	if n == len(keys) || tr.Height() < 3 {
+		t.Fatalf("expected the reserve to run out, inserted %v", n)
+	}
+	if d := after.TotalAlloc - before.TotalAlloc; d >= 1024 {
+		t.Fatalf("allocated %v bytes beyond the reserve", d)
+	}
+}
+
+func TestClear(t *testing.T) {
+	keys := randKeys(10_000)
+	for _, pooled := range []bool{false, true} {
+		var tr BTree
+		tr.UseNodePool(pooled)
+		for i := 0; i < 3; i++ {
+			for _, key := range keys {
+				tr.Set(key)
+			}
+			if err := tr.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if tr.Len() != len(keys) {
+				t.Fatalf("expected %v, got %v", len(keys), tr.Len())
+			}
+			tr.Clear(i%2 == 0)
+			if tr.Len() != 0 || tr.Get(keys[0]) {
+				t.Fatal("expected empty tree")
+			}
+		}
+	}
+
+	// released nodes return to the reserve
+	var tr BTree
+	tr.Reserve(0)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	nodes := tr.Stats().Nodes
+	tr.Clear(true)
+	if tr.Reserved() != nodes {
+		t.Fatalf("expected %v, got %v", nodes, tr.Reserved())
+	}
+}
+
+func TestReserveRebuild(t *testing.T) {
+	keys := randKeys(10_000)
+	var tr BTree
+	tr.Reserve(len(keys))
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	total := tr.Reserved() + tr.Stats().Nodes
+	sort.Strings(keys)
+	// the dropped nodes return to the reserve
+	tr.DeleteRange(keys[1000], keys[9000])
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Len() != 2000 {
+		t.Fatalf("expected 2000, got %v", tr.Len())
+	}
+	if n := tr.Reserved() + tr.Stats().Nodes; n != total {
+		t.Fatalf("expected %v nodes, got %v", total, n)
+	}
+}
+
+func TestReserveReadFrom(t *testing.T) {
+	keys := randKeys(10_000)
+	var src BTree
+	for _, key := range keys[:1000] {
+		src.Set(key)
+	}
+	var buf bytes.Buffer
+	if _, err := src.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var tr BTree
+	tr.Reserve(0)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	tr.Reserve(100)
+	total := tr.Reserved() + tr.Stats().Nodes
+	// the new nodes come from the reserve and the replaced ones return to it
+	if _, err := tr.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Len() != 1000 {
+		t.Fatalf("expected 1000, got %v", tr.Len())
+	}
+	if n := tr.Reserved() + tr.Stats().Nodes; n != total {
+		t.Fatalf("expected %v nodes, got %v", total, n)
+	}
+}
+
+func BenchmarkPooledChurn(b *testing.B) {
+	keys := randKeys(10_000)
+	var tr BTree
+	tr.UseNodePool(true)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			tr.Set(key)
+		}
+		tr.Clear(true)
+	}
+}
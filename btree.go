@@ -1,24 +1,65 @@
 package tinybtree
 
+import (
+	"encoding/base64"
+	"sort"
+)
+
 const maxItems = 255
 const minItems = maxItems * 40 / 100
 
+// maxHeight is the most levels a tree reaches, far beyond what fits in
+// memory.
+const maxHeight = 8
+
 type item struct {
 	key string
 }
 
 type node struct {
 	numItems int
+	count    int // number of items in the subtree
 	items    [maxItems]item
-	children [maxItems + 1]*node
+	children *[maxItems + 1]*node // nil for leaves
+	isoid    uint64               // owned by the tree with the same isoid
 }
 
 // BTree is an ordered set of key/value pairs where the key is a string
 // and the value is an interface{}
+//
+// A tree must not be modified while it's being iterated, either from
+// inside an iterator callback that goes on to return true or between the
+// steps of an Iterator. Doing so panics instead of silently skipping or
+// repeating keys. A callback may modify the tree when it returns false,
+// which stops the iteration.
 type BTree struct {
-	height int
-	root   *node
-	length int
+	height   int
+	root     *node
+	length   int
+	reserved bool                   // nodes are recycled through the reserve
+	reserve  []*node                // unused nodes, see Reserve
+	kids     []*[maxItems + 1]*node // unused child arrays, see Reserve
+	pooled   bool                   // nodes are recycled through nodePool
+	gen      uint64                 // incremented on every modification
+	isoid    uint64                 // nodes with another isoid are shared
+
+	onDelete  func(key string)       // see OnDelete
+	onReplace func(prev, key string) // see OnReplace
+}
+
+const errModified = "tinybtree: tree modified during iteration"
+
+// guard wraps iter so that it panics if the tree is modified by iter and
+// iteration would continue.
+func (tr *BTree) guard(iter func(key string) bool) func(key string) bool {
+	gen := tr.gen
+	return func(key string) bool {
+		ok := iter(key)
+		if ok && tr.gen != gen {
+			panic(errModified)
+		}
+		return ok
+	}
 }
 
 func (n *node) find(key string) (index int, found bool) {
@@ -42,42 +83,142 @@ func (n *node) find(key string) (index int, found bool) {
 	return index, found
 }
 
-// Set or replace a value for a key
+// PathHint is used with the *Hint functions to remember the path of the
+// last traversal. Operations on keys that are close to each other, such as
+// keys with a shared timestamp prefix, can then skip most binary searches.
+type PathHint struct {
+	path [maxHeight]uint8
+}
+
+func (n *node) findHint(key string, hint *PathHint, depth int) (
+	index int, found bool,
+) {
+	if hint == nil || depth >= len(hint.path) {
+		return n.find(key)
+	}
+	i := int(hint.path[depth])
+	if i > n.numItems {
+		i = n.numItems
+	}
+	if i < n.numItems && n.items[i].key == key {
+		index, found = i, true
+	} else if (i == 0 || n.items[i-1].key < key) &&
+		(i == n.numItems || key < n.items[i].key) {
+		index, found = i, false
+	} else {
+		index, found = n.find(key)
+	}
+	hint.path[depth] = uint8(index)
+	return index, found
+}
+
+// Set or replace a value for a key. When replaced, prev is the key that
+// was displaced.
 func (tr *BTree) Set(key string) (
-	replaced bool,
+	prev string, replaced bool,
+) {
+	return tr.SetHint(key, nil)
+}
+
+// SetNX inserts key only if it isn't already in the tree, returning true
+// if it was inserted. It's a single traversal.
+func (tr *BTree) SetNX(key string) (inserted bool) {
+	_, replaced := tr.set(key, nil, false)
+	return !replaced
+}
+
+// SetHint sets or replaces a value for a key using a path hint
+func (tr *BTree) SetHint(key string, hint *PathHint) (
+	prev string, replaced bool,
+) {
+	prev, replaced = tr.set(key, hint, true)
+	if replaced && tr.onReplace != nil {
+		tr.onReplace(prev, key)
+	}
+	return prev, replaced
+}
+
+// set inserts key, or replaces the item equal to it if replace is true.
+func (tr *BTree) set(key string, hint *PathHint, replace bool) (
+	prev string, replaced bool,
 ) {
 	if tr.root == nil {
-		tr.root = new(node)
+		tr.root = tr.newNode()
 		tr.root.items[0] = item{key}
 		tr.root.numItems = 1
+		tr.root.count = 1
 		tr.length = 1
+		tr.gen++
 		return
 	}
-	replaced = tr.root.set(key, tr.height)
-	if replaced {
-		return
+	// descend to the leaf, remembering the path so that counts can be
+	// updated and full nodes split on the way back up.
+	var stack [maxHeight]pathItem
+	path := stack[:0]
+	n := tr.root
+	for depth := 0; ; depth++ {
+		i, found := n.findHint(key, hint, depth)
+		if found {
+			prev = n.items[i].key
+			// the keys are equal, so a node that's shared with a snapshot
+			// is left as it is instead of being copied with its path
+			if replace && n.isoid == tr.isoid {
+				n.items[i] = item{key}
+			}
+			return prev, true
+		}
+		if depth == tr.height {
+			// the key is new, copy the shared nodes on the path
+			n = tr.cow(tr.root)
+			tr.root = n
+			for j := range path {
+				path[j].n = n
+				n.children[path[j].i] = tr.cow(n.children[path[j].i])
+				n = n.children[path[j].i]
+			}
+			copy(n.items[i+1:n.numItems+1], n.items[i:n.numItems])
+			n.items[i] = item{key}
+			n.numItems++
+			n.count++
+			break
+		}
+		path = append(path, pathItem{n, i})
+		n = n.children[i]
+	}
+	for j := len(path) - 1; j >= 0; j-- {
+		n, i := path[j].n, path[j].i
+		n.count++
+		if n.children[i].numItems == maxItems {
+			n.splitChild(tr, i, tr.height-j-1)
+		}
 	}
 	if tr.root.numItems == maxItems {
 		n := tr.root
-		right, median := n.split(tr.height)
-		tr.root = new(node)
+		right, median := n.split(tr, tr.height)
+		tr.root = tr.newBranch()
 		tr.root.children[0] = n
 		tr.root.items[0] = median
 		tr.root.children[1] = right
 		tr.root.numItems = 1
+		tr.root.count = n.count + right.count + 1
 		tr.height++
 	}
 	tr.length++
+	tr.gen++
 	return
 }
 
-func (n *node) split(height int) (right *node, median item) {
-	right = new(node)
+// split moves the upper half of a full node into a new right node and
+// returns it with the median item.
+func (n *node) split(tr *BTree, height int) (right *node, median item) {
 	median = n.items[maxItems/2]
-	copy(right.items[:maxItems/2], n.items[maxItems/2+1:])
 	if height > 0 {
+		right = tr.newBranch()
 		copy(right.children[:maxItems/2+1], n.children[maxItems/2+1:])
+	} else {
+		right = tr.newNode()
 	}
+	copy(right.items[:maxItems/2], n.items[maxItems/2+1:])
 	right.numItems = maxItems / 2
 	if height > 0 {
 		for i := maxItems/2 + 1; i < maxItems+1; i++ {
@@ -88,43 +229,69 @@ func (n *node) split(height int) (right *node, median item) {
 		n.items[i] = item{}
 	}
 	n.numItems = maxItems / 2
+	right.count = right.sumCount(height)
+	n.count -= right.count + 1
 	return
 }
 
-func (n *node) set(key string, height int) (
-	replaced bool,
-) {
-	i, found := n.find(key)
-	if found {
-		return true
-	}
-	if height == 0 {
-		for j := n.numItems; j > i; j-- {
-			n.items[j] = n.items[j-1]
+func (n *node) sumCount(height int) int {
+	count := n.numItems
+	if height > 0 {
+		for i := 0; i <= n.numItems; i++ {
+			count += n.children[i].count
 		}
-		n.items[i] = item{key}
-		n.numItems++
-		return false
 	}
-	replaced = n.children[i].set(key, height-1)
-	if replaced {
-		return
+	return count
+}
+
+type pathItem struct {
+	n *node
+	i int
+}
+
+// splitChild splits the full child at index i, which is at height.
+func (n *node) splitChild(tr *BTree, i, height int) {
+	right, median := n.children[i].split(tr, height)
+	copy(n.children[i+2:n.numItems+2], n.children[i+1:n.numItems+1])
+	copy(n.items[i+1:n.numItems+1], n.items[i:n.numItems])
+	n.items[i] = median
+	n.children[i+1] = right
+	n.numItems++
+}
+
+// SetBatch inserts all keys and returns the number of keys that weren't
+// already in the tree. The keys are applied in sorted order through a
+// shared path hint, so adjacent keys skip most binary searches.
+func (tr *BTree) SetBatch(keys []string) (inserted int) {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	var hint PathHint
+	for _, key := range sorted {
+		if _, ok := tr.SetHint(key, &hint); !ok {
+			inserted++
+		}
 	}
-	if n.children[i].numItems == maxItems {
-		right, median := n.children[i].split(height - 1)
-		copy(n.children[i+1:], n.children[i:])
-		copy(n.items[i+1:], n.items[i:])
-		n.items[i] = median
-		n.children[i+1] = right
-		n.numItems++
+	return inserted
+}
+
+// DeleteBatch deletes all keys and returns the number of keys that were
+// deleted. Like SetBatch, it applies the keys in sorted order.
+func (tr *BTree) DeleteBatch(keys []string) (deleted int) {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	var hint PathHint
+	for _, key := range sorted {
+		if _, ok := tr.DeleteHint(key, &hint); ok {
+			deleted++
+		}
 	}
-	return
+	return deleted
 }
 
 // Scan all items in tree
 func (tr *BTree) Scan(iter func(key string) bool) {
 	if tr.root != nil {
-		tr.root.scan(iter, tr.height)
+		tr.root.scan(tr.guard(iter), tr.height)
 	}
 }
 
@@ -150,23 +317,140 @@ func (n *node) scan(
 	return n.children[n.numItems].scan(iter, height-1)
 }
 
+// Walk passes all keys in ascending order to iter in batches, one batch
+// per leaf plus single key batches for the separators between leaves. The
+// slice is reused, so it's only valid until iter returns.
+func (tr *BTree) Walk(iter func(keys []string) bool) {
+	if tr.root != nil {
+		var buf [maxItems]string
+		gen := tr.gen
+		tr.root.walk(func(keys []string) bool {
+			ok := iter(keys)
+			if ok && tr.gen != gen {
+				panic(errModified)
+			}
+			return ok
+		}, buf[:], tr.height)
+	}
+}
+
+func (n *node) walk(
+	iter func(keys []string) bool, buf []string, height int,
+) bool {
+	if height == 0 {
+		for i := 0; i < n.numItems; i++ {
+			buf[i] = n.items[i].key
+		}
+		return iter(buf[:n.numItems])
+	}
+	for i := 0; i < n.numItems; i++ {
+		if !n.children[i].walk(iter, buf, height-1) {
+			return false
+		}
+		buf[0] = n.items[i].key
+		if !iter(buf[:1]) {
+			return false
+		}
+	}
+	return n.children[n.numItems].walk(iter, buf, height-1)
+}
+
 // Get a value for key
 func (tr *BTree) Get(key string) (gotten bool) {
+	return tr.GetHint(key, nil)
+}
+
+// GetHint gets a value for key using a path hint
+func (tr *BTree) GetHint(key string, hint *PathHint) (gotten bool) {
 	if tr.root == nil {
 		return
 	}
-	return tr.root.get(key, tr.height)
+	n := tr.root
+	for depth := 0; ; depth++ {
+		i, found := n.findHint(key, hint, depth)
+		if found {
+			return true
+		}
+		if depth == tr.height {
+			return false
+		}
+		n = n.children[i]
+	}
 }
 
-func (n *node) get(key string, height int) (gotten bool) {
-	i, found := n.find(key)
-	if found {
-		return true
+// Floor returns the greatest key that is less than or equal to key.
+func (tr *BTree) Floor(key string) (floor string, gotten bool) {
+	if tr.root == nil {
+		return
 	}
-	if height == 0 {
-		return false
+	n := tr.root
+	for height := tr.height; ; height-- {
+		i, found := n.find(key)
+		if found {
+			return n.items[i].key, true
+		}
+		if i > 0 {
+			floor, gotten = n.items[i-1].key, true
+		}
+		if height == 0 {
+			return floor, gotten
+		}
+		n = n.children[i]
+	}
+}
+
+// Ceiling returns the smallest key that is greater than or equal to key.
+func (tr *BTree) Ceiling(key string) (ceiling string, gotten bool) {
+	if tr.root == nil {
+		return
+	}
+	n := tr.root
+	for height := tr.height; ; height-- {
+		i, found := n.find(key)
+		if found {
+			return n.items[i].key, true
+		}
+		if i < n.numItems {
+			ceiling, gotten = n.items[i].key, true
+		}
+		if height == 0 {
+			return ceiling, gotten
+		}
+		n = n.children[i]
+	}
+}
+
+// ContainsAll returns true if every one of keys is in the tree. The keys
+// are checked in sorted order with a single cursor, so nearby keys share
+// most of their descent, and it stops at the first missing key.
+func (tr *BTree) ContainsAll(keys []string) bool {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	iter := tr.Iter()
+	for _, key := range sorted {
+		if !iter.SkipTo(key) || iter.Key() != key {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsAny returns true if at least one of keys is in the tree. Like
+// ContainsAll, it shares descents between sorted keys and stops at the
+// first match.
+func (tr *BTree) ContainsAny(keys []string) bool {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	iter := tr.Iter()
+	for _, key := range sorted {
+		if !iter.SkipTo(key) {
+			return false
+		}
+		if iter.Key() == key {
+			return true
+		}
 	}
-	return n.children[i].get(key, height-1)
+	return false
 }
 
 // Len returns the number of items in the tree
@@ -174,36 +458,486 @@ func (tr *BTree) Len() int {
 	return tr.length
 }
 
-// Delete a value for a key
-func (tr *BTree) Delete(key string) (deleted bool) {
+// GetAt returns the key at index, where zero is the smallest key.
+func (tr *BTree) GetAt(index int) (key string, gotten bool) {
+	if tr.root == nil || index < 0 || index >= tr.length {
+		return
+	}
+	n := tr.root
+	for height := tr.height; ; height-- {
+		if height == 0 {
+			return n.items[index].key, true
+		}
+		i := 0
+		for ; i < n.numItems; i++ {
+			if index < n.children[i].count {
+				break
+			}
+			index -= n.children[i].count
+			if index == 0 {
+				return n.items[i].key, true
+			}
+			index--
+		}
+		n = n.children[i]
+	}
+}
+
+// IndexOf returns the index of key. When key is not in the tree the
+// returned index is where it would be if it were inserted.
+func (tr *BTree) IndexOf(key string) (index int, found bool) {
+	if tr.root == nil {
+		return
+	}
+	n := tr.root
+	for height := tr.height; ; height-- {
+		i, found := n.find(key)
+		index += i
+		if height == 0 {
+			return index, found
+		}
+		for j := 0; j < i; j++ {
+			index += n.children[j].count
+		}
+		if found {
+			return index + n.children[i].count, true
+		}
+		n = n.children[i]
+	}
+}
+
+// CountRange returns the number of keys within the range
+// [greaterOrEqual, lessThan) in O(log n), without visiting them.
+func (tr *BTree) CountRange(greaterOrEqual, lessThan string) int {
+	lo, _ := tr.IndexOf(greaterOrEqual)
+	hi, _ := tr.IndexOf(lessThan)
+	if hi < lo {
+		return 0
+	}
+	return hi - lo
+}
+
+// Delete a value for a key. When deleted, prev is the key that was
+// removed.
+func (tr *BTree) Delete(key string) (prev string, deleted bool) {
+	return tr.DeleteHint(key, nil)
+}
+
+// DeleteHint deletes a value for a key using a path hint
+func (tr *BTree) DeleteHint(key string, hint *PathHint) (
+	prev string, deleted bool,
+) {
+	item, deleted := tr.delete(delKey, key, hint)
+	return item.key, deleted
+}
+
+type deleteAct int
+
+const (
+	delKey deleteAct = iota // delete the item matching the key
+	delMin                  // delete the smallest item
+	delMax                  // delete the largest item
+)
+
+func (tr *BTree) delete(act deleteAct, key string, hint *PathHint) (
+	prev item, deleted bool,
+) {
 	if tr.root == nil {
 		return
 	}
-	_, deleted = tr.root.delete(false, key, tr.height)
+	if act == delKey && tr.isoid != 0 && !tr.GetHint(key, hint) {
+		// once there are snapshots, look the key up first so that a
+		// missing key doesn't copy the shared nodes on its path
+		return
+	}
+	tr.root = tr.cow(tr.root)
+	prev, deleted = tr.root.delete(tr, act, key, tr.height, hint, 0)
 	if !deleted {
 		return
 	}
 
 	if tr.root.numItems == 0 {
-		tr.root = tr.root.children[0]
-		tr.height--
+		old := tr.root
+		if tr.height == 0 {
+			tr.root = nil
+		} else {
+			tr.root = old.children[0]
+			tr.height--
+		}
+		tr.freeNode(old)
 	}
 	tr.length--
+	tr.gen++
 	if tr.length == 0 {
 		tr.root = nil
 		tr.height = 0
 	}
+	if tr.onDelete != nil {
+		tr.onDelete(prev.key)
+	}
 	return
 }
 
-func (n *node) delete(max bool, key string, height int) (
+// Min returns the smallest key in the tree
+func (tr *BTree) Min() (key string, gotten bool) {
+	if tr.root == nil {
+		return
+	}
+	n := tr.root
+	for height := tr.height; height > 0; height-- {
+		n = n.children[0]
+	}
+	return n.items[0].key, true
+}
+
+// Max returns the largest key in the tree
+func (tr *BTree) Max() (key string, gotten bool) {
+	if tr.root == nil {
+		return
+	}
+	n := tr.root
+	for height := tr.height; height > 0; height-- {
+		n = n.children[n.numItems]
+	}
+	return n.items[n.numItems-1].key, true
+}
+
+// PopMin removes and returns the smallest key in the tree
+func (tr *BTree) PopMin() (key string, deleted bool) {
+	prev, deleted := tr.delete(delMin, "", nil)
+	return prev.key, deleted
+}
+
+// PopMax removes and returns the largest key in the tree
+func (tr *BTree) PopMax() (key string, deleted bool) {
+	prev, deleted := tr.delete(delMax, "", nil)
+	return prev.key, deleted
+}
+
+// DeleteRange deletes all keys within the range [greaterOrEqual, lessThan)
+// and returns the number of keys deleted. It's a single pass down the two
+// edges of the range: subtrees entirely within the range are dropped
+// whole, so the cost depends on the height of the tree and not on the
+// number of keys deleted, unless OnDelete has to be told about each of
+// them.
+func (tr *BTree) DeleteRange(greaterOrEqual, lessThan string) (deleted int) {
+	return tr.deleteRange(greaterOrEqual, lessThan, true)
+}
+
+// DeletePrefix deletes all keys that start with prefix and returns the
+// number of keys deleted. Like DeleteRange, it drops the subtrees that
+// hold only keys with the prefix without visiting them.
+func (tr *BTree) DeletePrefix(prefix string) (deleted int) {
+	// the smallest string greater than every key with the prefix
+	end := []byte(prefix)
+	for len(end) > 0 && end[len(end)-1] == 0xff {
+		end = end[:len(end)-1]
+	}
+	if len(end) == 0 {
+		return tr.deleteRange(prefix, "", false)
+	}
+	end[len(end)-1]++
+	return tr.deleteRange(prefix, string(end), true)
+}
+
+func (tr *BTree) deleteRange(
+	greaterOrEqual, lessThan string, bounded bool,
+) (deleted int) {
+	lo, _ := tr.IndexOf(greaterOrEqual)
+	hi := tr.length
+	if bounded {
+		hi, _ = tr.IndexOf(lessThan)
+	}
+	if hi <= lo {
+		return 0
+	}
+	c := rangeCut{tr: tr, lo: greaterOrEqual, hi: lessThan, bounded: bounded,
+		report: tr.onDelete != nil}
+	tr.root, tr.height = c.cut(tr.root, tr.height)
+	if tr.root == nil {
+		tr.height = 0
+	}
+	tr.length -= hi - lo
+	tr.gen++
+	for _, key := range c.keys {
+		tr.onDelete(key)
+	}
+	return hi - lo
+}
+
+// rangeCut removes the keys within [lo, hi) from a tree, or [lo, last] when
+// it isn't bounded.
+type rangeCut struct {
+	tr      *BTree
+	lo, hi  string
+	bounded bool
+	report  bool     // collect the removed keys for OnDelete
+	keys    []string // the removed keys in ascending order
+}
+
+// cut removes the range from the subtree n at height and returns what's
+// left, which may be lower than height or nil. Only the returned root may
+// be underfull. The run of items within the range is removed from each
+// node, the children between them are dropped without being visited, and
+// the children that straddle the ends of the range are cut recursively and
+// then joined back into the node.
+func (c *rangeCut) cut(n *node, height int) (*node, int) {
+	tr := c.tr
+	n = tr.cow(n)
+	i, _ := n.find(c.lo)
+	j := n.numItems
+	if c.bounded {
+		j, _ = n.find(c.hi)
+	}
+	if height == 0 {
+		if c.report {
+			for k := i; k < j; k++ {
+				c.keys = append(c.keys, n.items[k].key)
+			}
+		}
+		c.remove(n, i, j)
+		n.count = n.numItems
+		if n.numItems == 0 {
+			tr.freeNode(n)
+			return nil, -1
+		}
+		return n, 0
+	}
+	if i == j {
+		x, xh := c.cut(n.children[i], height-1)
+		tr.fixChild(n, i, x, xh, height)
+	} else {
+		a, ah := c.cut(n.children[i], height-1)
+		for k := i; k < j; k++ {
+			if c.report {
+				c.keys = append(c.keys, n.items[k].key)
+			}
+			if k+1 < j {
+				c.drop(n.children[k+1], height-1)
+			}
+		}
+		b, bh := c.cut(n.children[j], height-1)
+		copy(n.children[i+1:], n.children[j+1:n.numItems+1])
+		for k := n.numItems - (j - i) + 1; k <= n.numItems; k++ {
+			n.children[k] = nil
+		}
+		c.remove(n, i, j)
+		x, xh := tr.join2(a, ah, b, bh)
+		if n.numItems == 0 {
+			tr.freeNode(n)
+			return x, xh
+		}
+		if xh == height {
+			// the join split, which takes the place of a removed item
+			copy(n.items[i+1:], n.items[i:n.numItems])
+			copy(n.children[i+2:], n.children[i+1:n.numItems+1])
+			n.items[i] = x.items[0]
+			n.children[i] = x.children[0]
+			n.children[i+1] = x.children[1]
+			n.numItems++
+			tr.freeNode(x)
+		} else {
+			tr.fixChild(n, i, x, xh, height)
+		}
+	}
+	if n.numItems == 0 {
+		x := n.children[0]
+		tr.freeNode(n)
+		return x, height - 1
+	}
+	n.count = n.sumCount(height)
+	return n, height
+}
+
+// remove removes the items i through j-1 from n.
+func (c *rangeCut) remove(n *node, i, j int) {
+	copy(n.items[i:], n.items[j:n.numItems])
+	for k := n.numItems - (j - i); k < n.numItems; k++ {
+		n.items[k] = item{}
+	}
+	n.numItems -= j - i
+}
+
+// drop discards a subtree that's entirely within the range.
+func (c *rangeCut) drop(n *node, height int) {
+	if c.report {
+		n.scan(func(key string) bool {
+			c.keys = append(c.keys, key)
+			return true
+		}, height)
+	}
+	if c.tr.reserved || c.tr.pooled {
+		n.release(c.tr, height)
+	}
+}
+
+// fixChild puts the subtree x at height xh in place of the child at index
+// i of n, which is at height. When x is lower than its siblings or
+// underfull, it's joined with a sibling through the item between them.
+func (tr *BTree) fixChild(n *node, i int, x *node, xh, height int) {
+	if xh == height-1 && x.numItems >= minItems {
+		n.children[i] = x
+		return
+	}
+	var y *node
+	var yh int
+	if i > 0 {
+		i--
+		y, yh = tr.join(n.children[i], height-1, n.items[i], x, xh)
+	} else {
+		y, yh = tr.join(x, xh, n.items[0], n.children[1], height-1)
+	}
+	if yh == height {
+		// the join split, put both halves back
+		n.items[i] = y.items[0]
+		n.children[i] = y.children[0]
+		n.children[i+1] = y.children[1]
+		tr.freeNode(y)
+		return
+	}
+	n.children[i] = y
+	copy(n.items[i:], n.items[i+1:n.numItems])
+	copy(n.children[i+1:], n.children[i+2:n.numItems+1])
+	n.items[n.numItems-1] = item{}
+	n.children[n.numItems] = nil
+	n.numItems--
+}
+
+// join2 joins the subtrees l and r, where every key in l is less than
+// every key in r. Either may be nil, with a height of -1.
+func (tr *BTree) join2(l *node, lh int, r *node, rh int) (*node, int) {
+	if l == nil {
+		return r, rh
+	}
+	if r == nil {
+		return l, lh
+	}
+	// borrow the largest key of l as the separator
+	l = tr.cow(l)
+	sep, _ := l.delete(tr, delMax, "", lh, nil, 0)
+	if l.numItems == 0 {
+		old := l
+		if lh == 0 {
+			l, lh = nil, -1
+		} else {
+			l, lh = old.children[0], lh-1
+		}
+		tr.freeNode(old)
+	}
+	return tr.join(l, lh, sep, r, rh)
+}
+
+// join joins the subtrees l and r of any height through sep, which is
+// greater than every key in l and less than every key in r. Either subtree
+// may be nil, with a height of -1, but not both. The lower subtree is
+// joined into the edge of the higher one at its own height, and the
+// result is at most one level higher than the higher subtree.
+func (tr *BTree) join(l *node, lh int, sep item, r *node, rh int) (
+	*node, int,
+) {
+	switch {
+	case lh > rh:
+		l = tr.cow(l)
+		if lh == 0 {
+			l.items[l.numItems] = sep
+			l.numItems++
+		} else {
+			x, xh := tr.join(l.children[l.numItems], lh-1, sep, r, rh)
+			if xh < lh {
+				l.children[l.numItems] = x
+			} else {
+				l.items[l.numItems] = x.items[0]
+				l.children[l.numItems] = x.children[0]
+				l.children[l.numItems+1] = x.children[1]
+				l.numItems++
+				tr.freeNode(x)
+			}
+		}
+		return tr.grow(l, lh)
+	case lh < rh:
+		r = tr.cow(r)
+		if rh == 0 {
+			copy(r.items[1:], r.items[:r.numItems])
+			r.items[0] = sep
+			r.numItems++
+		} else {
+			x, xh := tr.join(l, lh, sep, r.children[0], rh-1)
+			if xh < rh {
+				r.children[0] = x
+			} else {
+				copy(r.items[1:], r.items[:r.numItems])
+				copy(r.children[2:], r.children[1:r.numItems+1])
+				r.items[0] = x.items[0]
+				r.children[0] = x.children[0]
+				r.children[1] = x.children[1]
+				r.numItems++
+				tr.freeNode(x)
+			}
+		}
+		return tr.grow(r, rh)
+	}
+	l = tr.cow(l)
+	if l.numItems+r.numItems+1 < maxItems {
+		// merge left + sep + right
+		l.items[l.numItems] = sep
+		copy(l.items[l.numItems+1:], r.items[:r.numItems])
+		if lh > 0 {
+			copy(l.children[l.numItems+1:], r.children[:r.numItems+1])
+		}
+		l.numItems += r.numItems + 1
+		l.count += r.count + 1
+		tr.freeNode(r)
+		return l, lh
+	}
+	// too many items for one node, split them evenly under a new root
+	r = tr.cow(r)
+	root := tr.newBranch()
+	root.items[0] = sep
+	root.children[0] = l
+	root.children[1] = r
+	root.numItems = 1
+	if d := l.numItems - r.numItems; d > 1 {
+		moveRight(root, 0, l, r, d/2, lh)
+	} else if d < -1 {
+		moveLeft(root, 0, l, r, -d/2, lh)
+	}
+	l.count = l.sumCount(lh)
+	r.count = r.sumCount(lh)
+	root.count = root.sumCount(lh + 1)
+	return root, lh + 1
+}
+
+// grow fixes the count of n, which may have gained an item, and splits it
+// under a new root when it's full.
+func (tr *BTree) grow(n *node, height int) (*node, int) {
+	n.count = n.sumCount(height)
+	if n.numItems < maxItems {
+		return n, height
+	}
+	right, median := n.split(tr, height)
+	root := tr.newBranch()
+	root.items[0] = median
+	root.children[0] = n
+	root.children[1] = right
+	root.numItems = 1
+	root.count = n.count + right.count + 1
+	return root, height + 1
+}
+
+func (n *node) delete(
+	tr *BTree, act deleteAct, key string, height int, hint *PathHint,
+	depth int,
+) (
 	prev item, deleted bool,
 ) {
 	i, found := 0, false
-	if max {
+	switch act {
+	case delMax:
 		i, found = n.numItems-1, true
-	} else {
-		i, found = n.find(key)
+	case delMin:
+		i, found = 0, height == 0
+	default:
+		i, found = n.findHint(key, hint, depth)
 	}
 	if height == 0 {
 		if found {
@@ -211,33 +945,39 @@ func (n *node) delete(max bool, key string, height int) (
 			// found the items at the leaf, remove it and return.
 			copy(n.items[i:], n.items[i+1:n.numItems])
 			n.items[n.numItems-1] = item{}
-			n.children[n.numItems] = nil
 			n.numItems--
+			n.count--
 			return prev, true
 		}
 		return item{}, false
 	}
 
+	if found && act == delMax {
+		i++
+	}
+	n.children[i] = tr.cow(n.children[i])
 	if found {
-		if max {
-			i++
-			prev, deleted = n.children[i].delete(true, "", height-1)
+		if act == delMax {
+			prev, deleted = n.children[i].delete(tr, delMax, "", height-1, nil, 0)
 		} else {
 			prev = n.items[i]
-			maxItem, _ := n.children[i].delete(true, "", height-1)
+			maxItem, _ := n.children[i].delete(tr, delMax, "", height-1, nil, 0)
 			n.items[i] = maxItem
 			deleted = true
 		}
 	} else {
-		prev, deleted = n.children[i].delete(max, key, height-1)
+		prev, deleted = n.children[i].delete(tr, act, key, height-1,
+			hint, depth+1)
 	}
 	if !deleted {
 		return
 	}
+	n.count--
 	if n.children[i].numItems < minItems {
 		if i == n.numItems {
 			i--
 		}
+		n.children[i] = tr.cow(n.children[i])
 		if n.children[i].numItems+n.children[i+1].numItems+1 < maxItems {
 			// merge left + item + right
 			n.children[i].items[n.children[i].numItems] = n.items[i]
@@ -248,13 +988,22 @@ func (n *node) delete(max bool, key string, height int) (
 					n.children[i+1].children[:n.children[i+1].numItems+1])
 			}
 			n.children[i].numItems += n.children[i+1].numItems + 1
+			n.children[i].count += n.children[i+1].count + 1
+			tr.freeNode(n.children[i+1])
 			copy(n.items[i:], n.items[i+1:n.numItems])
 			copy(n.children[i+1:], n.children[i+2:n.numItems+1])
-			n.items[n.numItems] = item{}
-			n.children[n.numItems+1] = nil
+			n.items[n.numItems-1] = item{}
+			n.children[n.numItems] = nil
 			n.numItems--
 		} else if n.children[i].numItems > n.children[i+1].numItems {
 			// move left -> right
+			n.children[i+1] = tr.cow(n.children[i+1])
+			moved := 1
+			if height > 1 {
+				moved += n.children[i].children[n.children[i].numItems].count
+			}
+			n.children[i].count -= moved
+			n.children[i+1].count += moved
 			copy(n.children[i+1].items[1:],
 				n.children[i+1].items[:n.children[i+1].numItems])
 			if height > 1 {
@@ -275,6 +1024,13 @@ func (n *node) delete(max bool, key string, height int) (
 			n.children[i].numItems--
 		} else {
 			// move right -> left
+			n.children[i+1] = tr.cow(n.children[i+1])
+			moved := 1
+			if height > 1 {
+				moved += n.children[i+1].children[0].count
+			}
+			n.children[i].count += moved
+			n.children[i+1].count -= moved
 			n.children[i].items[n.children[i].numItems] = n.items[i]
 			if height > 1 {
 				n.children[i].children[n.children[i].numItems+1] =
@@ -284,9 +1040,11 @@ func (n *node) delete(max bool, key string, height int) (
 			n.items[i] = n.children[i+1].items[0]
 			copy(n.children[i+1].items[:],
 				n.children[i+1].items[1:n.children[i+1].numItems])
+			n.children[i+1].items[n.children[i+1].numItems-1] = item{}
 			if height > 1 {
 				copy(n.children[i+1].children[:],
 					n.children[i+1].children[1:n.children[i+1].numItems+1])
+				n.children[i+1].children[n.children[i+1].numItems] = nil
 			}
 			n.children[i+1].numItems--
 		}
@@ -300,7 +1058,7 @@ func (tr *BTree) Ascend(
 	iter func(key string) bool,
 ) {
 	if tr.root != nil {
-		tr.root.ascend(pivot, iter, tr.height)
+		tr.root.ascend(pivot, tr.guard(iter), tr.height)
 	}
 }
 
@@ -333,7 +1091,7 @@ func (n *node) ascend(
 // Reverse all items in tree
 func (tr *BTree) Reverse(iter func(key string) bool) {
 	if tr.root != nil {
-		tr.root.reverse(iter, tr.height)
+		tr.root.reverse(tr.guard(iter), tr.height)
 	}
 }
 
@@ -368,7 +1126,7 @@ func (tr *BTree) Descend(
 	iter func(key string) bool,
 ) {
 	if tr.root != nil {
-		tr.root.descend(pivot, iter, tr.height)
+		tr.root.descend(pivot, tr.guard(iter), tr.height)
 	}
 }
 
@@ -398,3 +1156,652 @@ func (n *node) descend(
 	}
 	return true
 }
+
+// AscendGreater ascends the tree within the range (pivot, last]
+func (tr *BTree) AscendGreater(
+	pivot string,
+	iter func(key string) bool,
+) {
+	if tr.root != nil {
+		tr.root.ascendGreater(pivot, tr.guard(iter), tr.height)
+	}
+}
+
+func (n *node) ascendGreater(
+	pivot string,
+	iter func(key string) bool,
+	height int,
+) bool {
+	i, found := n.find(pivot)
+	if found {
+		if height > 0 {
+			if !n.children[i+1].scan(iter, height-1) {
+				return false
+			}
+		}
+		i++
+	} else if height > 0 {
+		if !n.children[i].ascendGreater(pivot, iter, height-1) {
+			return false
+		}
+	}
+	for ; i < n.numItems; i++ {
+		if !iter(n.items[i].key) {
+			return false
+		}
+		if height > 0 {
+			if !n.children[i+1].scan(iter, height-1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// DescendLess descends the tree within the range (pivot, first]
+func (tr *BTree) DescendLess(
+	pivot string,
+	iter func(key string) bool,
+) {
+	if tr.root != nil {
+		tr.root.descendLess(pivot, tr.guard(iter), tr.height)
+	}
+}
+
+func (n *node) descendLess(
+	pivot string,
+	iter func(key string) bool,
+	height int,
+) bool {
+	i, found := n.find(pivot)
+	if found {
+		if height > 0 {
+			if !n.children[i].reverse(iter, height-1) {
+				return false
+			}
+		}
+	} else if height > 0 {
+		if !n.children[i].descendLess(pivot, iter, height-1) {
+			return false
+		}
+	}
+	for i--; i >= 0; i-- {
+		if !iter(n.items[i].key) {
+			return false
+		}
+		if height > 0 {
+			if !n.children[i].reverse(iter, height-1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// AscendRange ascends the tree within the range [greaterOrEqual, lessThan)
+func (tr *BTree) AscendRange(
+	greaterOrEqual, lessThan string,
+	iter func(key string) bool,
+) {
+	if tr.root != nil {
+		tr.root.ascendRange(greaterOrEqual, lessThan, tr.guard(iter), tr.height)
+	}
+}
+
+func (n *node) ascendRange(
+	greaterOrEqual, lessThan string,
+	iter func(key string) bool,
+	height int,
+) bool {
+	i, found := n.find(greaterOrEqual)
+	if !found {
+		if height > 0 {
+			if !n.children[i].ascendRange(greaterOrEqual, lessThan, iter,
+				height-1) {
+				return false
+			}
+		}
+	}
+	for ; i < n.numItems; i++ {
+		if n.items[i].key >= lessThan {
+			return false
+		}
+		if !iter(n.items[i].key) {
+			return false
+		}
+		if height > 0 {
+			if !n.children[i+1].ascendLess(lessThan, iter, height-1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (n *node) ascendLess(
+	lessThan string,
+	iter func(key string) bool,
+	height int,
+) bool {
+	for i := 0; i < n.numItems; i++ {
+		if height > 0 {
+			if !n.children[i].ascendLess(lessThan, iter, height-1) {
+				return false
+			}
+		}
+		if n.items[i].key >= lessThan {
+			return false
+		}
+		if !iter(n.items[i].key) {
+			return false
+		}
+	}
+	if height > 0 {
+		return n.children[n.numItems].ascendLess(lessThan, iter, height-1)
+	}
+	return true
+}
+
+// DescendRange descends the tree within the range (greaterThan, lessOrEqual]
+func (tr *BTree) DescendRange(
+	lessOrEqual, greaterThan string,
+	iter func(key string) bool,
+) {
+	if tr.root != nil {
+		tr.root.descendRange(lessOrEqual, greaterThan, tr.guard(iter), tr.height)
+	}
+}
+
+func (n *node) descendRange(
+	lessOrEqual, greaterThan string,
+	iter func(key string) bool,
+	height int,
+) bool {
+	i, found := n.find(lessOrEqual)
+	if !found {
+		if height > 0 {
+			if !n.children[i].descendRange(lessOrEqual, greaterThan, iter,
+				height-1) {
+				return false
+			}
+		}
+		i--
+	}
+	for ; i >= 0; i-- {
+		if n.items[i].key <= greaterThan {
+			return false
+		}
+		if !iter(n.items[i].key) {
+			return false
+		}
+		if height > 0 {
+			if !n.children[i].descendGreater(greaterThan, iter, height-1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (n *node) descendGreater(
+	greaterThan string,
+	iter func(key string) bool,
+	height int,
+) bool {
+	if height > 0 {
+		if !n.children[n.numItems].descendGreater(greaterThan, iter,
+			height-1) {
+			return false
+		}
+	}
+	for i := n.numItems - 1; i >= 0; i-- {
+		if n.items[i].key <= greaterThan {
+			return false
+		}
+		if !iter(n.items[i].key) {
+			return false
+		}
+		if height > 0 {
+			if !n.children[i].descendGreater(greaterThan, iter, height-1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Copy returns a deep copy of the tree. The copy shares no nodes with the
+// original, so either can be modified freely. Key strings are immutable
+// and are shared.
+func (tr *BTree) Copy() *BTree {
+	tr2 := &BTree{height: tr.height, length: tr.length, pooled: tr.pooled}
+	if tr.root != nil {
+		tr2.root = tr.root.copy(tr2, tr.height)
+	}
+	return tr2
+}
+
+func (n *node) copy(tr *BTree, height int) *node {
+	n2 := tr.newNode()
+	*n2 = *n
+	n2.isoid = tr.isoid
+	if height > 0 {
+		n2.children = tr.newChildren()
+		for i := 0; i <= n.numItems; i++ {
+			n2.children[i] = n.children[i].copy(tr, height-1)
+		}
+	}
+	return n2
+}
+
+// Equal returns true if both trees hold the same keys. It walks the trees
+// in lockstep and stops at the first difference. A nil tree is empty.
+func (tr *BTree) Equal(other *BTree) bool {
+	var n, m int
+	if tr != nil {
+		n = tr.length
+	}
+	if other != nil {
+		m = other.length
+	}
+	return n == m && tr.Compare(other) == 0
+}
+
+// Compare compares the ordered key sequences of both trees
+// lexicographically, returning -1, 0, or +1. A tree that's a prefix of the
+// other compares as less, and a nil tree is empty. A subtree that both
+// trees reach at the same point of the sequence, such as the nodes that a
+// tree still shares with its snapshot, is skipped without visiting it.
+func (tr *BTree) Compare(other *BTree) int {
+	if tr == other {
+		return 0
+	}
+	var stackA, stackB [maxHeight]cmpFrame
+	a, b := newCmpCursor(tr, stackA[:0]), newCmpCursor(other, stackB[:0])
+	for {
+		na, ha, ka, okA := a.peek()
+		nb, hb, kb, okB := b.peek()
+		switch {
+		case !okA && !okB:
+			return 0
+		case !okA:
+			return -1
+		case !okB:
+			return +1
+		case na != nil && na == nb:
+			// the same node holds the same keys
+			a.skip()
+			b.skip()
+		case na != nil || nb != nil:
+			// descend the higher subtree first, so that shared nodes
+			// below it line up with the other side
+			if na != nil && (nb == nil || ha >= hb) {
+				a.descend()
+			}
+			if nb != nil && (na == nil || hb >= ha) {
+				b.descend()
+			}
+		case ka < kb:
+			return -1
+		case ka > kb:
+			return +1
+		default:
+			a.skip()
+			b.skip()
+		}
+	}
+}
+
+// cmpCursor walks a tree for Compare, one child subtree or key at a time.
+type cmpCursor struct {
+	stack []cmpFrame
+}
+
+// cmpFrame is a node with its height and the position of the next child
+// or key in it. In a branch the even positions are the children and the
+// odd positions the keys between them.
+type cmpFrame struct {
+	n      *node
+	height int
+	pos    int
+}
+
+func newCmpCursor(tr *BTree, stack []cmpFrame) cmpCursor {
+	if tr != nil && tr.root != nil {
+		stack = append(stack, cmpFrame{tr.root, tr.height, 0})
+	}
+	return cmpCursor{stack}
+}
+
+// peek returns the next child subtree with its height, or else the next
+// key.
+func (c *cmpCursor) peek() (sub *node, height int, key string, ok bool) {
+	for len(c.stack) > 0 {
+		f := &c.stack[len(c.stack)-1]
+		switch {
+		case f.height == 0 && f.pos < f.n.numItems:
+			return nil, 0, f.n.items[f.pos].key, true
+		case f.height > 0 && f.pos <= 2*f.n.numItems:
+			if f.pos%2 == 0 {
+				return f.n.children[f.pos/2], f.height - 1, "", true
+			}
+			return nil, 0, f.n.items[f.pos/2].key, true
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	return nil, 0, "", false
+}
+
+// skip moves past the next child subtree or key.
+func (c *cmpCursor) skip() {
+	c.stack[len(c.stack)-1].pos++
+}
+
+// descend moves into the next child subtree.
+func (c *cmpCursor) descend() {
+	f := &c.stack[len(c.stack)-1]
+	f.pos++
+	c.stack = append(c.stack, cmpFrame{f.n.children[f.pos/2], f.height - 1, 0})
+}
+
+// Limit wraps iter so that iteration stops after n keys. The wrapped
+// iterator is never called again once the limit is reached, so it can be
+// passed to Scan, Ascend, Descend and the other callback iterators.
+func Limit(n int, iter func(key string) bool) func(key string) bool {
+	return func(key string) bool {
+		if n <= 0 {
+			return false
+		}
+		n--
+		return iter(key) && n > 0
+	}
+}
+
+// ScanFrom returns up to limit keys in ascending order, starting after the
+// position described by cursor, and the cursor for the next page. An empty
+// cursor starts at the first key and an empty next cursor means there are
+// no more keys. Cursors are opaque, URL safe, and stay valid while the tree
+// is modified: a page always continues after the last key of the previous
+// page, whether or not that key still exists. A limit below one is treated
+// as one.
+func (tr *BTree) ScanFrom(cursor string, limit int) (
+	keys []string, next string, err error,
+) {
+	if limit < 1 {
+		limit = 1
+	}
+	iter := tr.Iter()
+	var ok bool
+	if cursor == "" {
+		ok = iter.First()
+	} else {
+		if cursor[0] != 'k' {
+			return nil, "", ErrInvalidCursor
+		}
+		after, err := base64.RawURLEncoding.DecodeString(cursor[1:])
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		ok = iter.Seek(string(after))
+		if ok && iter.Key() == string(after) {
+			ok = iter.Next()
+		}
+	}
+	for ; ok && len(keys) < limit; ok = iter.Next() {
+		keys = append(keys, iter.Key())
+	}
+	if ok {
+		next = "k" + base64.RawURLEncoding.EncodeToString(
+			[]byte(keys[len(keys)-1]))
+	}
+	return keys, next, nil
+}
+
+// Iterator is a stateful cursor over the keys of a tree. It keeps an
+// explicit path from the root to the current item, so a scan can be paused
+// and resumed, or advanced in lockstep with another iterator.
+// The iterator is invalidated by any modification to the tree.
+type Iterator struct {
+	tr      *BTree
+	gen     uint64
+	seeked  bool
+	atstart bool
+	atend   bool
+	stack   []iterStackItem
+	peek    []iterStackItem
+	key     string
+}
+
+type iterStackItem struct {
+	n *node
+	i int
+}
+
+// Iter returns a cursor positioned before the first key in the tree.
+func (tr *BTree) Iter() Iterator {
+	return Iterator{tr: tr}
+}
+
+// check panics if the tree was modified since the cursor was positioned.
+func (it *Iterator) check() {
+	if it.seeked && it.gen != it.tr.gen {
+		panic(errModified)
+	}
+}
+
+func (it *Iterator) leaf() bool {
+	return len(it.stack)-1 == it.tr.height
+}
+
+func (it *Iterator) reset() {
+	it.gen = it.tr.gen
+	it.seeked = true
+	it.atstart = false
+	it.atend = false
+	it.stack = it.stack[:0]
+}
+
+// Seek to the first key that is greater than or equal to key.
+func (it *Iterator) Seek(key string) bool {
+	if it.tr == nil {
+		return false
+	}
+	it.reset()
+	if it.tr.root == nil {
+		return false
+	}
+	return it.seek(key, it.tr.root)
+}
+
+func (it *Iterator) seek(key string, n *node) bool {
+	for {
+		i, found := n.find(key)
+		it.stack = append(it.stack, iterStackItem{n, i})
+		if found {
+			it.key = n.items[i].key
+			return true
+		}
+		if it.leaf() {
+			it.stack[len(it.stack)-1].i--
+			return it.Next()
+		}
+		n = n.children[i]
+	}
+}
+
+// First moves the cursor to the first key in the tree.
+func (it *Iterator) First() bool {
+	if it.tr == nil {
+		return false
+	}
+	it.reset()
+	if it.tr.root == nil {
+		return false
+	}
+	n := it.tr.root
+	for {
+		it.stack = append(it.stack, iterStackItem{n, 0})
+		if it.leaf() {
+			break
+		}
+		n = n.children[0]
+	}
+	it.key = n.items[0].key
+	return true
+}
+
+// Last moves the cursor to the last key in the tree.
+func (it *Iterator) Last() bool {
+	if it.tr == nil {
+		return false
+	}
+	it.reset()
+	if it.tr.root == nil {
+		return false
+	}
+	n := it.tr.root
+	for {
+		it.stack = append(it.stack, iterStackItem{n, n.numItems})
+		if it.leaf() {
+			it.stack[len(it.stack)-1].i--
+			break
+		}
+		n = n.children[n.numItems]
+	}
+	it.key = n.items[n.numItems-1].key
+	return true
+}
+
+// Next moves the cursor to the next key. An unpositioned cursor moves to
+// the first key.
+func (it *Iterator) Next() bool {
+	if it.tr == nil {
+		return false
+	}
+	it.check()
+	if !it.seeked {
+		return it.First()
+	}
+	if len(it.stack) == 0 {
+		if it.atstart {
+			return it.First()
+		}
+		return false
+	}
+	s := &it.stack[len(it.stack)-1]
+	s.i++
+	if it.leaf() {
+		for s.i == s.n.numItems {
+			it.stack = it.stack[:len(it.stack)-1]
+			if len(it.stack) == 0 {
+				it.atend = true
+				return false
+			}
+			s = &it.stack[len(it.stack)-1]
+		}
+	} else {
+		n := s.n.children[s.i]
+		for {
+			it.stack = append(it.stack, iterStackItem{n, 0})
+			if it.leaf() {
+				break
+			}
+			n = n.children[0]
+		}
+		s = &it.stack[len(it.stack)-1]
+	}
+	it.key = s.n.items[s.i].key
+	return true
+}
+
+// Prev moves the cursor to the previous key. An unpositioned cursor moves
+// to the last key.
+func (it *Iterator) Prev() bool {
+	if it.tr == nil {
+		return false
+	}
+	it.check()
+	if !it.seeked {
+		return it.Last()
+	}
+	if len(it.stack) == 0 {
+		if it.atend {
+			return it.Last()
+		}
+		return false
+	}
+	s := &it.stack[len(it.stack)-1]
+	if it.leaf() {
+		s.i--
+		for s.i == -1 {
+			it.stack = it.stack[:len(it.stack)-1]
+			if len(it.stack) == 0 {
+				it.atstart = true
+				return false
+			}
+			s = &it.stack[len(it.stack)-1]
+			s.i--
+		}
+	} else {
+		n := s.n.children[s.i]
+		for {
+			it.stack = append(it.stack, iterStackItem{n, n.numItems})
+			if it.leaf() {
+				it.stack[len(it.stack)-1].i--
+				break
+			}
+			n = n.children[n.numItems]
+		}
+		s = &it.stack[len(it.stack)-1]
+	}
+	it.key = s.n.items[s.i].key
+	return true
+}
+
+// Key returns the key at the current cursor position.
+func (it *Iterator) Key() string {
+	return it.key
+}
+
+// Peek returns the next key without moving the cursor.
+func (it *Iterator) Peek() (key string, ok bool) {
+	tmp := *it
+	tmp.stack = append(it.peek[:0], it.stack...)
+	ok = tmp.Next()
+	it.peek = tmp.stack[:0]
+	if !ok {
+		return "", false
+	}
+	return tmp.key, true
+}
+
+// SkipTo moves the cursor forward to the first key that is greater than or
+// equal to key. The cursor never moves backwards, and the search starts
+// from the current position rather than the root.
+func (it *Iterator) SkipTo(key string) bool {
+	if it.tr == nil {
+		return false
+	}
+	it.check()
+	if len(it.stack) == 0 {
+		if it.atend {
+			return false
+		}
+		return it.Seek(key)
+	}
+	if key <= it.key {
+		return true
+	}
+	// climb until the key falls within the current subtree
+	d := len(it.stack) - 1
+	for d > 0 {
+		p := it.stack[d-1]
+		if p.i < p.n.numItems && key <= p.n.items[p.i].key {
+			break
+		}
+		d--
+	}
+	n := it.stack[d].n
+	it.stack = it.stack[:d]
+	return it.seek(key, n)
+}
@@ -11,6 +11,7 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 func init() {
@@ -27,62 +28,12 @@ func randKeys(N int) (keys []string) {
 	return
 }
 
-const flatLeaf = true
-
-func (tr *BTree) print() {
-	tr.root.print(0, tr.height)
-}
-
-func (n *node) print(level, height int) {
-	if n == nil {
-		println("NIL")
-		return
-	}
-	if height == 0 && flatLeaf {
-		fmt.Printf("%s", strings.Repeat("  ", level))
-	}
-	for i := 0; i < n.numItems; i++ {
-		if height > 0 {
-			n.children[i].print(level+1, height-1)
-		}
-		if height > 0 || (height == 0 && !flatLeaf) {
-			fmt.Printf("%s%v\n", strings.Repeat("  ", level), n.items[i].key)
-		} else {
-			if i > 0 {
-				fmt.Printf(",")
-			}
-			fmt.Printf("%s", n.items[i].key)
-		}
-	}
-	if height == 0 && flatLeaf {
-		fmt.Printf("\n")
-	}
-	if height > 0 {
-		n.children[n.numItems].print(level+1, height-1)
-	}
-}
-
-func (tr *BTree) deepPrint() {
-	fmt.Printf("%#v\n", tr)
-	tr.root.deepPrint(0, tr.height)
-}
-
-func (n *node) deepPrint(level, height int) {
-	if n == nil {
-		fmt.Printf("%s %#v\n", strings.Repeat("  ", level), n)
-		return
-	}
-	fmt.Printf("%s count: %v\n", strings.Repeat("  ", level), n.numItems)
-	fmt.Printf("%s items: %v\n", strings.Repeat("  ", level), n.items)
-	if height > 0 {
-		fmt.Printf("%s child: %v\n", strings.Repeat("  ", level), n.children)
-	}
-	if height > 0 {
-		for i := 0; i < n.numItems; i++ {
-			n.children[i].deepPrint(level+1, height-1)
-		}
-		n.children[n.numItems].deepPrint(level+1, height-1)
-	}
+// dump logs the items on each level of the tree.
+func (tr *BTree) dump(t *testing.T) {
+	t.Helper()
+	tr.WalkLevels(func(level, numNodes int, items []string) {
+		t.Logf("level %d, %d nodes: %v", level, numNodes, items)
+	})
 }
 
 func stringsEquals(a, b []string) bool {
@@ -129,15 +80,16 @@ func TestDescend(t *testing.T) {
 			exp = exp[1:]
 		}
 		var count int
-		tr.Descend(key, func(key string) bool {
-			if count == (i+1)%maxItems {
-				return false
-			}
+		limit := (i + 1) % maxItems
+		tr.Descend(key, Limit(limit, func(key string) bool {
 			count++
 			return true
-		})
-		if count > len(exp) {
-			t.Fatalf("expected 1, got %v", count)
+		}))
+		if limit > len(exp) {
+			limit = len(exp)
+		}
+		if count != limit {
+			t.Fatalf("expected %v, got %v", limit, count)
 		}
 
 		if !stringsEquals(exp, all) {
@@ -181,15 +133,16 @@ func TestAscend(t *testing.T) {
 			exp = exp[1:]
 		}
 		var count int
-		tr.Ascend(key, func(key string) bool {
-			if count == (i+1)%maxItems {
-				return false
-			}
+		limit := (i + 1) % maxItems
+		tr.Ascend(key, Limit(limit, func(key string) bool {
 			count++
 			return true
-		})
-		if count > len(exp) {
-			t.Fatalf("expected 1, got %v", count)
+		}))
+		if limit > len(exp) {
+			limit = len(exp)
+		}
+		if count != limit {
+			t.Fatalf("expected %v, got %v", limit, count)
 		}
 		if !stringsEquals(exp, all) {
 			t.Fatal("mismatch")
@@ -204,7 +157,7 @@ func TestBTree(t *testing.T) {
 
 	// insert all items
 	for _, key := range keys {
-		replaced := tr.Set(key)
+		_, replaced := tr.Set(key)
 		if replaced {
 			t.Fatal("expected false")
 		}
@@ -285,9 +238,9 @@ func TestBTree(t *testing.T) {
 
 	// delete half the items
 	for _, key := range keys[:len(keys)/2] {
-		deleted := tr.Delete(key)
-		if !deleted {
-			tr.deepPrint()
+		prev, deleted := tr.Delete(key)
+		if !deleted || prev != key {
+			tr.dump(t)
 			t.Fatal("expected true")
 		}
 	}
@@ -299,7 +252,7 @@ func TestBTree(t *testing.T) {
 
 	// try delete half again
 	for _, key := range keys[:len(keys)/2] {
-		deleted := tr.Delete(key)
+		_, deleted := tr.Delete(key)
 		if deleted {
 			t.Fatal("expected false")
 		}
@@ -307,7 +260,7 @@ func TestBTree(t *testing.T) {
 
 	// try delete half again
 	for _, key := range keys[:len(keys)/2] {
-		deleted := tr.Delete(key)
+		_, deleted := tr.Delete(key)
 		if deleted {
 			t.Fatal("expected false")
 		}
@@ -335,15 +288,15 @@ func TestBTree(t *testing.T) {
 
 	// replace second half
 	for _, key := range keys[len(keys)/2:] {
-		replaced := tr.Set(key)
-		if !replaced {
-			t.Fatal("expected true")
+		prev, replaced := tr.Set(key)
+		if !replaced || prev != key {
+			t.Fatalf("expected '%v'/true, got '%v'/%v", key, prev, replaced)
 		}
 	}
 
 	// delete next half the items
 	for _, key := range keys[len(keys)/2:] {
-		deleted := tr.Delete(key)
+		_, deleted := tr.Delete(key)
 		if !deleted {
 			t.Fatal("expected true")
 		}
@@ -369,7 +322,7 @@ func TestBTree(t *testing.T) {
 	})
 
 	var deleted bool
-	deleted = tr.Delete("invalid")
+	_, deleted = tr.Delete("invalid")
 	if deleted {
 		t.Fatal("expected false")
 	}
@@ -398,6 +351,30 @@ func BenchmarkTidwallSequentialGet(b *testing.B) {
 	}
 }
 
+func BenchmarkTidwallSequentialSetHint(b *testing.B) {
+	var tr BTree
+	var hint PathHint
+	keys := randKeys(b.N)
+	sort.Strings(keys)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.SetHint(keys[i], &hint)
+	}
+}
+
+func BenchmarkTidwallRandomSetBatch(b *testing.B) {
+	var tr BTree
+	keys := randKeys(b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 10_000 {
+		j := i + 10_000
+		if j > b.N {
+			j = b.N
+		}
+		tr.SetBatch(keys[i:j])
+	}
+}
+
 func BenchmarkTidwallRandomSet(b *testing.B) {
 	var tr BTree
 	keys := randKeys(b.N)
@@ -574,7 +551,7 @@ func testBTreeRandom(t *testing.T, r *rand.Rand, keys []string, count *uint32) {
 	keys = keys[:rand.Intn(len(keys))]
 	shuffle(r, keys)
 	for i := 0; i < len(keys); i++ {
-		ok := tr.Set(keys[i])
+		_, ok := tr.Set(keys[i])
 		if ok {
 			t.Fatalf("expected nil")
 		}
@@ -588,17 +565,1022 @@ func testBTreeRandom(t *testing.T, r *rand.Rand, keys []string, count *uint32) {
 	}
 	shuffle(r, keys)
 	for i := 0; i < len(keys); i++ {
-		ok := tr.Delete(keys[i])
+		_, ok := tr.Delete(keys[i])
 		if !ok {
 			t.Fatalf("expected '%v', got '%v'", keys[i], "")
 		}
 		ok = tr.Get(keys[i])
 		if ok {
-			//tr.deepPrint()
+			tr.dump(t)
 			t.Fatalf("expected nil %d %d %d %s", len(keys), i, tr.Len(), keys[i])
-			tr.deepPrint()
-			panic("")
 		}
 	}
 	atomic.AddUint32(count, 1)
 }
+
+func TestIter(t *testing.T) {
+	var tr BTree
+	iter := tr.Iter()
+	if iter.First() || iter.Last() || iter.Next() || iter.Prev() ||
+		iter.Seek("1") {
+		t.Fatal("expected false")
+	}
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	sort.Strings(keys)
+
+	// forward
+	var all []string
+	iter = tr.Iter()
+	for iter.Next() {
+		all = append(all, iter.Key())
+	}
+	if !stringsEquals(keys, all) {
+		t.Fatal("mismatch")
+	}
+	if iter.Next() {
+		t.Fatal("expected false")
+	}
+	if !iter.Prev() || iter.Key() != keys[len(keys)-1] {
+		t.Fatalf("expected '%v', got '%v'", keys[len(keys)-1], iter.Key())
+	}
+
+	// backward
+	all = all[:0]
+	iter = tr.Iter()
+	for iter.Prev() {
+		all = append(all, iter.Key())
+	}
+	for i := 0; i < len(all); i++ {
+		if all[i] != keys[len(keys)-1-i] {
+			t.Fatal("mismatch")
+		}
+	}
+	if !iter.Next() || iter.Key() != keys[0] {
+		t.Fatalf("expected '%v', got '%v'", keys[0], iter.Key())
+	}
+
+	// seek and walk in both directions
+	for i := 0; i < 1000; i++ {
+		j := rand.Intn(len(keys))
+		pivot := keys[j] + "5"
+		if i%2 == 0 {
+			pivot = keys[j]
+		} else {
+			j++
+		}
+		ok := iter.Seek(pivot)
+		if j == len(keys) {
+			if ok {
+				t.Fatal("expected false")
+			}
+			continue
+		}
+		if !ok || iter.Key() != keys[j] {
+			t.Fatalf("expected '%v', got '%v'", keys[j], iter.Key())
+		}
+		for k := j + 1; k < j+300 && k < len(keys); k++ {
+			if !iter.Next() || iter.Key() != keys[k] {
+				t.Fatalf("expected '%v', got '%v'", keys[k], iter.Key())
+			}
+		}
+		iter.Seek(pivot)
+		for k := j - 1; k > j-300 && k >= 0; k-- {
+			if !iter.Prev() || iter.Key() != keys[k] {
+				t.Fatalf("expected '%v', got '%v'", keys[k], iter.Key())
+			}
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	var tr BTree
+	tr.AscendRange("1", "2", func(key string) bool {
+		t.Fatal("should not be reached")
+		return true
+	})
+	tr.DescendRange("2", "1", func(key string) bool {
+		t.Fatal("should not be reached")
+		return true
+	})
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	sort.Strings(keys)
+	for i := 0; i < 1000; i++ {
+		a, b := keys[rand.Intn(len(keys))], keys[rand.Intn(len(keys))]
+		if i%3 == 0 {
+			a += "5"
+		}
+		if a > b {
+			a, b = b, a
+		}
+		var exp, all []string
+		for _, key := range keys {
+			if key >= a && key < b {
+				exp = append(exp, key)
+			}
+		}
+		tr.AscendRange(a, b, func(key string) bool {
+			all = append(all, key)
+			return true
+		})
+		if !stringsEquals(exp, all) {
+			t.Fatal("mismatch")
+		}
+		if n := tr.CountRange(a, b); n != len(exp) {
+			t.Fatalf("expected %v, got %v", len(exp), n)
+		}
+		if n := tr.CountRange(b, a); n != 0 && a != b {
+			t.Fatalf("expected 0, got %v", n)
+		}
+		exp, all = exp[:0], all[:0]
+		for j := len(keys) - 1; j >= 0; j-- {
+			if keys[j] <= b && keys[j] > a {
+				exp = append(exp, keys[j])
+			}
+		}
+		tr.DescendRange(b, a, func(key string) bool {
+			all = append(all, key)
+			return true
+		})
+		if !stringsEquals(exp, all) {
+			t.Fatal("mismatch")
+		}
+		var count int
+		tr.AscendRange(a, b, func(key string) bool {
+			count++
+			return count < 10
+		})
+		if count > 10 {
+			t.Fatalf("expected 10, got %v", count)
+		}
+	}
+}
+
+func (n *node) checkCounts(t *testing.T, height int) {
+	if n.count != n.sumCount(height) {
+		t.Fatalf("expected count %v, got %v", n.sumCount(height), n.count)
+	}
+	if height > 0 {
+		for i := 0; i <= n.numItems; i++ {
+			n.children[i].checkCounts(t, height-1)
+		}
+	}
+}
+
+func TestFloorCeiling(t *testing.T) {
+	var tr BTree
+	if _, ok := tr.Floor("a"); ok {
+		t.Fatal("expected false")
+	}
+	if _, ok := tr.Ceiling("a"); ok {
+		t.Fatal("expected false")
+	}
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	sort.Strings(keys)
+	probes := []string{"", "\xff"}
+	for _, key := range keys {
+		probes = append(probes, key, key+"5", key[:len(key)-1])
+	}
+	for _, probe := range probes {
+		i := sort.SearchStrings(keys, probe)
+		var exp string
+		var expOK bool
+		if i < len(keys) && keys[i] == probe {
+			exp, expOK = probe, true
+		} else if i > 0 {
+			exp, expOK = keys[i-1], true
+		}
+		if floor, ok := tr.Floor(probe); floor != exp || ok != expOK {
+			t.Fatalf("Floor(%q): expected %q/%v, got %q/%v",
+				probe, exp, expOK, floor, ok)
+		}
+		exp, expOK = "", false
+		if i < len(keys) {
+			exp, expOK = keys[i], true
+		}
+		if ceil, ok := tr.Ceiling(probe); ceil != exp || ok != expOK {
+			t.Fatalf("Ceiling(%q): expected %q/%v, got %q/%v",
+				probe, exp, expOK, ceil, ok)
+		}
+	}
+}
+
+func TestGetAtIndexOf(t *testing.T) {
+	var tr BTree
+	if _, ok := tr.GetAt(0); ok {
+		t.Fatal("expected false")
+	}
+	if idx, ok := tr.IndexOf("1"); ok || idx != 0 {
+		t.Fatalf("expected 0/false, got %v/%v", idx, ok)
+	}
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	tr.root.checkCounts(t, tr.height)
+	for _, key := range keys[:len(keys)/2] {
+		tr.Delete(key)
+	}
+	tr.root.checkCounts(t, tr.height)
+	keys = keys[len(keys)/2:]
+	sort.Strings(keys)
+	for i, key := range keys {
+		got, ok := tr.GetAt(i)
+		if !ok || got != key {
+			t.Fatalf("expected '%v', got '%v'", key, got)
+		}
+		idx, ok := tr.IndexOf(key)
+		if !ok || idx != i {
+			t.Fatalf("expected %v, got %v", i, idx)
+		}
+		idx, ok = tr.IndexOf(key + "5")
+		if ok || idx != i+1 {
+			t.Fatalf("expected %v, got %v", i+1, idx)
+		}
+	}
+	if _, ok := tr.GetAt(-1); ok {
+		t.Fatal("expected false")
+	}
+	if _, ok := tr.GetAt(len(keys)); ok {
+		t.Fatal("expected false")
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	var tr BTree
+	if _, ok := tr.Min(); ok {
+		t.Fatal("expected false")
+	}
+	if _, ok := tr.Max(); ok {
+		t.Fatal("expected false")
+	}
+	if _, ok := tr.PopMin(); ok {
+		t.Fatal("expected false")
+	}
+	if _, ok := tr.PopMax(); ok {
+		t.Fatal("expected false")
+	}
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	sort.Strings(keys)
+	for len(keys) > 0 {
+		min, ok := tr.Min()
+		if !ok || min != keys[0] {
+			t.Fatalf("expected '%v', got '%v'", keys[0], min)
+		}
+		max, ok := tr.Max()
+		if !ok || max != keys[len(keys)-1] {
+			t.Fatalf("expected '%v', got '%v'", keys[len(keys)-1], max)
+		}
+		if rand.Intn(2) == 0 {
+			min, ok = tr.PopMin()
+			if !ok || min != keys[0] {
+				t.Fatalf("expected '%v', got '%v'", keys[0], min)
+			}
+			keys = keys[1:]
+		} else {
+			max, ok = tr.PopMax()
+			if !ok || max != keys[len(keys)-1] {
+				t.Fatalf("expected '%v', got '%v'", keys[len(keys)-1], max)
+			}
+			keys = keys[:len(keys)-1]
+		}
+		if tr.Len() != len(keys) {
+			t.Fatalf("expected %v, got %v", len(keys), tr.Len())
+		}
+		if len(keys)%1000 == 0 && tr.root != nil {
+			tr.root.checkCounts(t, tr.height)
+		}
+	}
+}
+
+func TestHint(t *testing.T) {
+	var tr BTree
+	var hint PathHint
+	keys := randKeys(10_000)
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	for _, keys := range [][]string{keys, sorted} {
+		for _, key := range keys {
+			if _, ok := tr.SetHint(key, &hint); ok {
+				t.Fatal("expected false")
+			}
+		}
+		for _, key := range keys {
+			if _, ok := tr.SetHint(key, &hint); !ok {
+				t.Fatal("expected true")
+			}
+			if !tr.GetHint(key, &hint) {
+				t.Fatal("expected true")
+			}
+			if tr.GetHint(key+"5", &hint) {
+				t.Fatal("expected false")
+			}
+		}
+		tr.root.checkCounts(t, tr.height)
+		for _, key := range keys {
+			if _, ok := tr.DeleteHint(key, &hint); !ok {
+				t.Fatal("expected true")
+			}
+			if tr.GetHint(key, &hint) {
+				t.Fatal("expected false")
+			}
+		}
+		if tr.Len() != 0 {
+			t.Fatalf("expected 0, got %v", tr.Len())
+		}
+	}
+}
+
+func TestIterPeekSkipTo(t *testing.T) {
+	var tr BTree
+	iter := tr.Iter()
+	if _, ok := iter.Peek(); ok {
+		t.Fatal("expected false")
+	}
+	if iter.SkipTo("1") {
+		t.Fatal("expected false")
+	}
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	sort.Strings(keys)
+	iter = tr.Iter()
+	for i := 0; i < len(keys); i++ {
+		key, ok := iter.Peek()
+		if !ok || key != keys[i] {
+			t.Fatalf("expected '%v', got '%v'", keys[i], key)
+		}
+		if !iter.Next() || iter.Key() != keys[i] {
+			t.Fatalf("expected '%v', got '%v'", keys[i], iter.Key())
+		}
+	}
+	if _, ok := iter.Peek(); ok {
+		t.Fatal("expected false")
+	}
+	for n := 0; n < 100; n++ {
+		iter = tr.Iter()
+		i := 0
+		for {
+			i += rand.Intn(500)
+			pivot := keys[len(keys)-1] + "5"
+			if i < len(keys) {
+				pivot = keys[i]
+				if rand.Intn(2) == 0 {
+					pivot += "5"
+					i++
+				}
+			}
+			if !iter.SkipTo(pivot) {
+				if i < len(keys) {
+					t.Fatalf("expected '%v'", keys[i])
+				}
+				break
+			}
+			if i >= len(keys) || iter.Key() != keys[i] {
+				t.Fatalf("expected '%v', got '%v'", keys[i], iter.Key())
+			}
+			// never moves backwards
+			if !iter.SkipTo(keys[0]) || iter.Key() != keys[i] {
+				t.Fatalf("expected '%v', got '%v'", keys[i], iter.Key())
+			}
+		}
+	}
+}
+
+func TestSetPrev(t *testing.T) {
+	var tr BTree
+	old, key := strings.Clone("hello"), strings.Clone("hello")
+	if prev, replaced := tr.Set(old); replaced || prev != "" {
+		t.Fatalf("expected ''/false, got '%v'/%v", prev, replaced)
+	}
+	// the displaced key is returned and the new one is kept
+	prev, replaced := tr.Set(key)
+	if !replaced || unsafe.StringData(prev) != unsafe.StringData(old) {
+		t.Fatal("expected the old key")
+	}
+	if min, _ := tr.Min(); unsafe.StringData(min) != unsafe.StringData(key) {
+		t.Fatal("expected the new key")
+	}
+	// SetNX leaves the stored key alone
+	tr.SetNX(old)
+	if min, _ := tr.Min(); unsafe.StringData(min) != unsafe.StringData(key) {
+		t.Fatal("expected the new key")
+	}
+	prev, deleted := tr.Delete("hello")
+	if !deleted || unsafe.StringData(prev) != unsafe.StringData(key) {
+		t.Fatal("expected the stored key")
+	}
+	if prev, deleted := tr.Delete("hello"); deleted || prev != "" {
+		t.Fatalf("expected ''/false, got '%v'/%v", prev, deleted)
+	}
+}
+
+func TestSetNX(t *testing.T) {
+	var tr BTree
+	keys := randKeys(1000)
+	for _, key := range keys {
+		if !tr.SetNX(key) {
+			t.Fatal("expected true")
+		}
+	}
+	for _, key := range keys {
+		if tr.SetNX(key) {
+			t.Fatal("expected false")
+		}
+	}
+	if tr.Len() != len(keys) {
+		t.Fatalf("expected %v, got %v", len(keys), tr.Len())
+	}
+}
+
+func TestDeleteRange(t *testing.T) {
+	var tr BTree
+	if tr.DeleteRange("0", "9") != 0 {
+		t.Fatal("expected 0")
+	}
+	for i := 0; i < 50; i++ {
+		tr = BTree{}
+		keys := randKeys(10_000)
+		for _, key := range keys {
+			tr.Set(key)
+		}
+		sort.Strings(keys)
+		a, b := keys[rand.Intn(len(keys))], keys[rand.Intn(len(keys))]
+		if i%3 == 0 {
+			a += "5"
+		}
+		if a > b {
+			a, b = b, a
+		}
+		var exp []string
+		var count int
+		for _, key := range keys {
+			if key < a || key >= b {
+				exp = append(exp, key)
+			} else {
+				count++
+			}
+		}
+		if n := tr.DeleteRange(a, b); n != count {
+			t.Fatalf("expected %v, got %v", count, n)
+		}
+		if tr.Len() != len(exp) {
+			t.Fatalf("expected %v, got %v", len(exp), tr.Len())
+		}
+		var all []string
+		tr.Scan(func(key string) bool {
+			all = append(all, key)
+			return true
+		})
+		if !stringsEquals(exp, all) {
+			t.Fatal("mismatch")
+		}
+		if err := tr.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeleteRangeShapes(t *testing.T) {
+	for _, N := range []int{1, 10, 254, 255, 1000, 65_000, 200_000} {
+		keys := randKeys(N)
+		sorted := append([]string(nil), keys...)
+		sort.Strings(sorted)
+		var tr BTree
+		for _, key := range keys {
+			tr.Set(key)
+		}
+		for i := 0; i < 20 && tr.Len() > 0; i++ {
+			// cut a copy so that the edges of the range go through
+			// shared nodes, and check that the source is left intact
+			snap := tr.ReadSnapshot()
+			lo := rand.Intn(len(sorted))
+			hi := lo + rand.Intn(len(sorted)-lo+1)
+			if i%4 == 0 {
+				hi = lo + rand.Intn(10)
+				if hi > len(sorted) {
+					hi = len(sorted)
+				}
+			}
+			var n int
+			if hi == len(sorted) {
+				n = tr.DeleteRange(sorted[lo], "\xff")
+			} else {
+				n = tr.DeleteRange(sorted[lo], sorted[hi])
+			}
+			if n != hi-lo {
+				t.Fatalf("expected %v, got %v", hi-lo, n)
+			}
+			if err := tr.Validate(); err != nil {
+				t.Fatalf("N=%v [%v, %v): %v", N, lo, hi, err)
+			}
+			if snap.Len() != len(sorted) {
+				t.Fatalf("snapshot changed")
+			}
+			sorted = append(sorted[:lo:lo], sorted[hi:]...)
+			var all []string
+			tr.Scan(func(key string) bool {
+				all = append(all, key)
+				return true
+			})
+			if !stringsEquals(sorted, all) {
+				t.Fatalf("N=%v: mismatch", N)
+			}
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	var tr BTree
+	if !tr.ContainsAll(nil) || tr.ContainsAny(nil) {
+		t.Fatal("bad result for no keys")
+	}
+	if tr.ContainsAll([]string{"1"}) || tr.ContainsAny([]string{"1"}) {
+		t.Fatal("expected false")
+	}
+	keys := randKeys(10_000)
+	for _, key := range keys[:len(keys)/2] {
+		tr.Set(key)
+	}
+	in, out := keys[:len(keys)/2], keys[len(keys)/2:]
+	for i := 0; i < 100; i++ {
+		var set []string
+		for j := 0; j < 50; j++ {
+			set = append(set, in[rand.Intn(len(in))])
+		}
+		if !tr.ContainsAll(set) || !tr.ContainsAny(set) {
+			t.Fatal("expected true")
+		}
+		miss := append(set, out[rand.Intn(len(out))])
+		miss[0], miss[len(miss)-1] = miss[len(miss)-1], miss[0]
+		if tr.ContainsAll(miss) || !tr.ContainsAny(miss) {
+			t.Fatal("bad result with one missing key")
+		}
+		if tr.ContainsAny(out[i*50 : i*50+50]) {
+			t.Fatal("expected false")
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var tr BTree
+	keys := randKeys(10_000)
+	if n := tr.SetBatch(keys[:len(keys)/2]); n != len(keys)/2 {
+		t.Fatalf("expected %v, got %v", len(keys)/2, n)
+	}
+	if n := tr.SetBatch(keys); n != len(keys)/2 {
+		t.Fatalf("expected %v, got %v", len(keys)/2, n)
+	}
+	if tr.Len() != len(keys) {
+		t.Fatalf("expected %v, got %v", len(keys), tr.Len())
+	}
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if n := tr.DeleteBatch(keys[:len(keys)/2]); n != len(keys)/2 {
+		t.Fatalf("expected %v, got %v", len(keys)/2, n)
+	}
+	if n := tr.DeleteBatch(keys); n != len(keys)/2 {
+		t.Fatalf("expected %v, got %v", len(keys)/2, n)
+	}
+	if tr.Len() != 0 {
+		t.Fatalf("expected 0, got %v", tr.Len())
+	}
+}
+
+func TestAscendGreaterDescendLess(t *testing.T) {
+	var tr BTree
+	tr.AscendGreater("1", func(key string) bool {
+		t.Fatal("should not be reached")
+		return true
+	})
+	tr.DescendLess("1", func(key string) bool {
+		t.Fatal("should not be reached")
+		return true
+	})
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	sort.Strings(keys)
+	for i := 0; i < 1000; i++ {
+		j := rand.Intn(len(keys))
+		pivot := keys[j]
+		if i%2 == 1 {
+			pivot += "5"
+		}
+		var exp, all []string
+		for _, key := range keys {
+			if key > pivot {
+				exp = append(exp, key)
+			}
+		}
+		tr.AscendGreater(pivot, func(key string) bool {
+			all = append(all, key)
+			return true
+		})
+		if !stringsEquals(exp, all) {
+			t.Fatal("mismatch")
+		}
+		exp, all = exp[:0], all[:0]
+		for k := len(keys) - 1; k >= 0; k-- {
+			if keys[k] < pivot {
+				exp = append(exp, keys[k])
+			}
+		}
+		tr.DescendLess(pivot, func(key string) bool {
+			all = append(all, key)
+			return true
+		})
+		if !stringsEquals(exp, all) {
+			t.Fatal("mismatch")
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	var tr BTree
+	if tr.Copy().Len() != 0 {
+		t.Fatal("expected empty copy")
+	}
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	tr2 := tr.Copy()
+	if err := tr2.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	// modifying one must not affect the other
+	for _, key := range keys[:len(keys)/2] {
+		tr.Delete(key)
+	}
+	tr2.Set("new")
+	if tr2.Len() != len(keys)+1 || tr.Len() != len(keys)/2 {
+		t.Fatalf("unexpected lengths %v and %v", tr2.Len(), tr.Len())
+	}
+	for _, key := range keys {
+		if !tr2.Get(key) {
+			t.Fatal("expected true")
+		}
+	}
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr2.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	var tr BTree
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	sort.Strings(keys)
+	mid := keys[len(keys)/2]
+	scans := []func(iter func(key string) bool){
+		tr.Scan,
+		tr.Reverse,
+		func(iter func(key string) bool) { tr.Ascend(mid, iter) },
+		func(iter func(key string) bool) { tr.Descend(mid, iter) },
+		func(iter func(key string) bool) { tr.AscendRange(mid, "~", iter) },
+		func(iter func(key string) bool) { tr.DescendRange(mid, "", iter) },
+	}
+	for _, scan := range scans {
+		for _, n := range []int{-1, 0, 1, 2, maxItems, 1000, len(keys)} {
+			var count int
+			var done bool
+			scan(Limit(n, func(key string) bool {
+				if done {
+					t.Fatal("callback after limit")
+				}
+				count++
+				return true
+			}))
+			done = true
+			if n < 0 {
+				n = 0
+			}
+			if count > n {
+				t.Fatalf("expected at most %v, got %v", n, count)
+			}
+			if n <= len(keys)/2 && count != n {
+				t.Fatalf("expected %v, got %v", n, count)
+			}
+		}
+	}
+	// the iterator can still stop early on its own
+	var count int
+	tr.Scan(Limit(100, func(key string) bool {
+		count++
+		return count < 10
+	}))
+	if count != 10 {
+		t.Fatalf("expected 10, got %v", count)
+	}
+}
+
+func TestScanFrom(t *testing.T) {
+	var tr BTree
+	keys, next, err := tr.ScanFrom("", 10)
+	if len(keys) != 0 || next != "" || err != nil {
+		t.Fatalf("expected empty page, got %v/%q/%v", keys, next, err)
+	}
+	all := randKeys(10_000)
+	for _, key := range all {
+		tr.Set(key)
+	}
+	sort.Strings(all)
+	var got []string
+	var cursor string
+	for {
+		keys, next, err := tr.ScanFrom(cursor, 333)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) > 333 {
+			t.Fatalf("expected at most 333, got %v", len(keys))
+		}
+		got = append(got, keys...)
+		if next == "" {
+			break
+		}
+		// deleting the last key of the page must not disturb paging
+		tr.Delete(keys[len(keys)-1])
+		cursor = next
+	}
+	if !stringsEquals(all, got) {
+		t.Fatal("mismatch")
+	}
+	if _, _, err := tr.ScanFrom("bogus", 10); err != ErrInvalidCursor {
+		t.Fatalf("expected '%v', got '%v'", ErrInvalidCursor, err)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	var tr BTree
+	tr.Walk(func(keys []string) bool {
+		t.Fatal("should not be reached")
+		return true
+	})
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	sort.Strings(keys)
+	var all []string
+	var calls int
+	tr.Walk(func(batch []string) bool {
+		all = append(all, batch...)
+		calls++
+		return true
+	})
+	if !stringsEquals(keys, all) {
+		t.Fatal("mismatch")
+	}
+	if calls >= len(keys)/10 {
+		t.Fatalf("expected batches, got %v calls", calls)
+	}
+	calls = 0
+	tr.Walk(func(batch []string) bool {
+		calls++
+		return calls < 3
+	})
+	if calls != 3 {
+		t.Fatalf("expected 3, got %v", calls)
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	var tr BTree
+	keys := randKeys(10_000)
+	var extra = []string{"\xff", "\xff\xff", "\xff\xffa", "\xfe\xff"}
+	for _, prefix := range []string{"0", "12", "999", "5555", "\xff", "\xff\xff",
+		"\xfe", ""} {
+		tr.Clear(false)
+		for _, key := range append(keys, extra...) {
+			tr.Set(key)
+		}
+		var count int
+		for _, key := range append(keys, extra...) {
+			if strings.HasPrefix(key, prefix) {
+				count++
+			}
+		}
+		if n := tr.DeletePrefix(prefix); n != count {
+			t.Fatalf("prefix %q: expected %v, got %v", prefix, count, n)
+		}
+		if tr.Len() != len(keys)+len(extra)-count {
+			t.Fatalf("expected %v, got %v", len(keys)+len(extra)-count,
+				tr.Len())
+		}
+		tr.Scan(func(key string) bool {
+			if strings.HasPrefix(key, prefix) {
+				t.Fatalf("prefix %q: key %q remains", prefix, key)
+			}
+			return true
+		})
+		if err := tr.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeletePrefixDropsSubtrees(t *testing.T) {
+	var tr BTree
+	tr.Reserve(0)
+	for i := 0; i < 100_000; i++ {
+		tr.Set(fmt.Sprintf("tenant%d:%06d", i%3, i))
+	}
+	nodes := tr.Stats().Nodes
+	var calls int
+	tr.OnDelete(func(key string) { calls++ })
+	if n := tr.DeletePrefix("tenant1:"); n != 33_333 {
+		t.Fatalf("expected 33333, got %v", n)
+	}
+	if calls != 33_333 {
+		t.Fatalf("expected 33333 calls, got %v", calls)
+	}
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	// the dropped nodes return to the reserve
+	if n := tr.Reserved() + tr.Stats().Nodes; n != nodes {
+		t.Fatalf("expected %v nodes, got %v", nodes, n)
+	}
+	if tr.Get("tenant1:000001") || !tr.Get("tenant2:000002") {
+		t.Fatal("bad keys after delete")
+	}
+}
+
+func TestEqualCompare(t *testing.T) {
+	var a, b BTree
+	if !a.Equal(&b) || a.Compare(&b) != 0 {
+		t.Fatal("expected empty trees to be equal")
+	}
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		a.Set(key)
+	}
+	if a.Equal(&b) || a.Compare(&b) != 1 || b.Compare(&a) != -1 {
+		t.Fatal("expected empty tree to be less")
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		b.Set(keys[i])
+	}
+	if !a.Equal(&b) || a.Compare(&b) != 0 || !a.Equal(a.Copy()) {
+		t.Fatal("expected equal")
+	}
+	b.Delete(keys[0])
+	b.Set(keys[0] + "5")
+	if a.Equal(&b) {
+		t.Fatal("expected not equal")
+	}
+	if a.Compare(&b) != -1 || b.Compare(&a) != 1 {
+		t.Fatalf("expected -1/1, got %v/%v", a.Compare(&b), b.Compare(&a))
+	}
+
+	// a nil tree is empty
+	var empty BTree
+	if !empty.Equal(nil) || a.Equal(nil) || a.Compare(nil) != 1 ||
+		(*BTree)(nil).Compare(&a) != -1 {
+		t.Fatal("expected nil to be empty")
+	}
+
+	// trees sharing nodes with a snapshot
+	all := func(tr *BTree) []string {
+		var keys []string
+		tr.Scan(func(key string) bool {
+			keys = append(keys, key)
+			return true
+		})
+		return keys
+	}
+	for i := 0; i < 100; i++ {
+		snap := a.ReadSnapshot()
+		key := keys[rand.Intn(len(keys))]
+		switch i % 3 {
+		case 0:
+			a.Delete(key)
+		case 1:
+			a.Set(key + "5")
+		case 2:
+			// the same keys in new nodes
+			a.Delete(key)
+			a.Set(key)
+		}
+		ka, kc := all(&a), snapshotKeys(snap)
+		exp := len(ka) - len(kc)
+		for j := 0; j < len(ka) && j < len(kc); j++ {
+			if ka[j] != kc[j] {
+				exp = strings.Compare(ka[j], kc[j])
+				break
+			}
+		}
+		if exp > 0 {
+			exp = 1
+		} else if exp < 0 {
+			exp = -1
+		}
+		if snap.Compare(&a) != -exp || snap.Equal(&a) != (exp == 0) {
+			t.Fatalf("expected %v, got %v", -exp, snap.Compare(&a))
+		}
+	}
+}
+
+func expectPanic(t *testing.T, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	fn()
+}
+
+func TestModifiedDuringIteration(t *testing.T) {
+	var tr BTree
+	keys := randKeys(1000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	expectPanic(t, func() {
+		tr.Scan(func(key string) bool {
+			tr.Delete(key)
+			return true
+		})
+	})
+	expectPanic(t, func() {
+		tr.Ascend("", func(key string) bool {
+			tr.Set(key + "5")
+			return true
+		})
+	})
+	expectPanic(t, func() {
+		tr.Walk(func(keys []string) bool {
+			tr.PopMin()
+			return true
+		})
+	})
+	// replacing an existing key doesn't modify the tree
+	tr.Scan(func(key string) bool {
+		tr.Set(key)
+		return true
+	})
+	// modifying and then stopping is fine, as in find, delete, stop
+	n := tr.Len()
+	tr.Ascend(keys[0], func(key string) bool {
+		tr.Delete(key)
+		return false
+	})
+	tr.Scan(func(key string) bool {
+		tr.Delete(key)
+		return false
+	})
+	tr.Walk(func(keys []string) bool {
+		tr.PopMin()
+		return false
+	})
+	if tr.Len() != n-3 {
+		t.Fatalf("expected %v, got %v", n-3, tr.Len())
+	}
+	iter := tr.Iter()
+	iter.First()
+	tr.Delete(iter.Key())
+	expectPanic(t, func() { iter.Next() })
+	// repositioning the cursor is fine
+	if !iter.First() || !iter.Next() {
+		t.Fatal("expected true")
+	}
+}
+
+func BenchmarkCompareSnapshot(b *testing.B) {
+	var tr BTree
+	keys := randKeys(1_000_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	snap := tr.ReadSnapshot()
+	tr.Delete(keys[0])
+	tr.Set(keys[0])
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !snap.Equal(&tr) {
+			b.Fatal("expected equal")
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package tinybtree
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// minParallel is the fewest keys per worker worth starting a goroutine for.
+const minParallel = 1 << 14
+
+// BuildParallel returns a new tree holding keys, built using up to workers
+// goroutines, or GOMAXPROCS when workers is zero or less. The keys are
+// copied and don't need to be sorted or unique. Sorting and filling the
+// leaves are split between the workers, and the few branch nodes above the
+// leaves are then built in one pass.
+func BuildParallel(keys []string, workers int) *BTree {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if max := len(keys) / minParallel; workers > max {
+		workers = max
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	sorted := append([]string(nil), keys...)
+	if !sort.StringsAreSorted(sorted) {
+		sortParallel(sorted, workers)
+	}
+	sorted = dedupe(sorted)
+	tr := new(BTree)
+	if len(sorted) == 0 {
+		return tr
+	}
+	// Leaf j holds the maxItems-1 keys starting at j*maxItems, followed by
+	// the separator that goes to the parent, which is the same layout the
+	// builder produces when keys are appended one by one.
+	leaves := make([]*node, len(sorted)/maxItems+1)
+	parallel(len(leaves), workers, func(lo, hi int) {
+		for j := lo; j < hi; j++ {
+			start := j * maxItems
+			end := start + maxItems - 1
+			if end > len(sorted) {
+				end = len(sorted)
+			}
+			n := new(node)
+			for k, key := range sorted[start:end] {
+				n.items[k] = item{key}
+			}
+			n.numItems = end - start
+			leaves[j] = n
+		}
+	})
+	b := builder{tr: tr, levels: []*node{leaves[0]}}
+	for j := 1; j < len(leaves); j++ {
+		b.push(1, sorted[j*maxItems-1], leaves[j])
+	}
+	b.levels[0] = leaves[len(leaves)-1]
+	b.length = len(sorted)
+	b.last = sorted[len(sorted)-1]
+	b.tree()
+	return tr
+}
+
+// parallel splits [0, n) into up to workers contiguous ranges and calls fn
+// for each range on its own goroutine.
+func parallel(n, workers int, fn func(lo, hi int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		fn(0, n)
+		return
+	}
+	var wg sync.WaitGroup
+	size := (n + workers - 1) / workers
+	for lo := 0; lo < n; lo += size {
+		hi := lo + size
+		if hi > n {
+			hi = n
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			fn(lo, hi)
+		}(lo, hi)
+	}
+	wg.Wait()
+}
+
+// sortParallel sorts runs of keys concurrently and then merges pairs of
+// runs, also concurrently, until one run is left.
+func sortParallel(keys []string, workers int) {
+	if workers <= 1 {
+		sort.Strings(keys)
+		return
+	}
+	size := (len(keys) + workers - 1) / workers
+	var runs [][2]int
+	for lo := 0; lo < len(keys); lo += size {
+		hi := lo + size
+		if hi > len(keys) {
+			hi = len(keys)
+		}
+		runs = append(runs, [2]int{lo, hi})
+	}
+	parallel(len(runs), len(runs), func(lo, hi int) {
+		for _, r := range runs[lo:hi] {
+			sort.Strings(keys[r[0]:r[1]])
+		}
+	})
+	src, dst := keys, make([]string, len(keys))
+	for len(runs) > 1 {
+		next := make([][2]int, (len(runs)+1)/2)
+		parallel(len(next), len(next), func(lo, hi int) {
+			for i := lo; i < hi; i++ {
+				a := runs[2*i]
+				if 2*i+1 == len(runs) {
+					copy(dst[a[0]:a[1]], src[a[0]:a[1]])
+					next[i] = a
+					continue
+				}
+				b := runs[2*i+1]
+				merge(dst[a[0]:b[1]], src[a[0]:a[1]], src[b[0]:b[1]])
+				next[i] = [2]int{a[0], b[1]}
+			}
+		})
+		src, dst = dst, src
+		runs = next
+	}
+	if &src[0] != &keys[0] {
+		copy(keys, src)
+	}
+}
+
+// merge merges the sorted a and b into dst.
+func merge(dst, a, b []string) {
+	i, j, k := 0, 0, 0
+	for i < len(a) && j < len(b) {
+		if b[j] < a[i] {
+			dst[k] = b[j]
+			j++
+		} else {
+			dst[k] = a[i]
+			i++
+		}
+		k++
+	}
+	k += copy(dst[k:], a[i:])
+	copy(dst[k:], b[j:])
+}
+
+// dedupe removes adjacent duplicates from the sorted keys in place.
+func dedupe(keys []string) []string {
+	if len(keys) == 0 {
+		return keys
+	}
+	j := 1
+	for i := 1; i < len(keys); i++ {
+		if keys[i] != keys[j-1] {
+			keys[j] = keys[i]
+			j++
+		}
+	}
+	return keys[:j]
+}
@@ -0,0 +1,59 @@
+package tinybtree
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestBuildParallel(t *testing.T) {
+	for _, N := range []int{0, 1, 254, 255, 256, 1000, 254*255 + 254,
+		100_000, 300_000} {
+		keys := randKeys(N)
+		sorted := append([]string(nil), keys...)
+		sort.Strings(sorted)
+		unsorted := append(append([]string(nil), keys...), keys[:N/3]...)
+		for i, workers := range []int{0, 1, 3, 8} {
+			input := unsorted
+			if i%2 == 1 {
+				input = sorted
+			}
+			tr := BuildParallel(input, workers)
+			if err := tr.Validate(); err != nil {
+				t.Fatalf("%v/%v: %v", N, workers, err)
+			}
+			var all []string
+			tr.Scan(func(key string) bool {
+				all = append(all, key)
+				return true
+			})
+			if !stringsEquals(all, sorted) {
+				t.Fatalf("%v/%v: mismatch", N, workers)
+			}
+		}
+	}
+	// the input is left alone
+	keys := []string{"c", "a", "b", "a"}
+	BuildParallel(keys, 2)
+	if !stringsEquals(keys, []string{"c", "a", "b", "a"}) {
+		t.Fatalf("input modified: %v", keys)
+	}
+}
+
+func TestSortParallel(t *testing.T) {
+	keys := randKeys(100_000)
+	for _, workers := range []int{1, 2, 3, 7, 16} {
+		sorted := append([]string(nil), keys...)
+		sortParallel(sorted, workers)
+		if !sort.StringsAreSorted(sorted) || len(sorted) != len(keys) {
+			t.Fatalf("%v: not sorted", workers)
+		}
+	}
+}
+
+func BenchmarkBuildParallel(b *testing.B) {
+	keys := randKeys(1_000_000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		BuildParallel(keys, 0)
+	}
+}
@@ -0,0 +1,72 @@
+package tinybtree
+
+import "unsafe"
+
+// BTreeBytes is an ordered set of []byte keys, ordered the same way as
+// bytes.Compare. Lookups don't convert or copy the key; it's only copied
+// when it's inserted.
+type BTreeBytes struct {
+	tr BTree
+}
+
+// bstr returns the bytes as a string without copying. The string must not
+// be retained by the tree.
+func bstr(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// sbytes returns the string as bytes without copying. The bytes must not
+// be modified.
+func sbytes(s string) []byte {
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
+
+// SetBytes sets or replaces a value for a key. The key is copied only if
+// it's inserted.
+func (tr *BTreeBytes) SetBytes(key []byte) (replaced bool) {
+	var hint PathHint
+	if tr.tr.GetHint(bstr(key), &hint) {
+		return true
+	}
+	tr.tr.SetHint(string(key), &hint)
+	return false
+}
+
+// GetBytes gets a value for key
+func (tr *BTreeBytes) GetBytes(key []byte) (gotten bool) {
+	return tr.tr.Get(bstr(key))
+}
+
+// DeleteBytes deletes a value for a key
+func (tr *BTreeBytes) DeleteBytes(key []byte) (deleted bool) {
+	_, deleted = tr.tr.Delete(bstr(key))
+	return deleted
+}
+
+// Len returns the number of items in the tree
+func (tr *BTreeBytes) Len() int {
+	return tr.tr.Len()
+}
+
+// Scan all items in tree. The keys passed to iter must not be modified.
+func (tr *BTreeBytes) Scan(iter func(key []byte) bool) {
+	tr.tr.Scan(func(key string) bool {
+		return iter(sbytes(key))
+	})
+}
+
+// Ascend the tree within the range [pivot, last]. The keys passed to iter
+// must not be modified.
+func (tr *BTreeBytes) Ascend(pivot []byte, iter func(key []byte) bool) {
+	tr.tr.Ascend(bstr(pivot), func(key string) bool {
+		return iter(sbytes(key))
+	})
+}
+
+// Descend the tree within the range [pivot, first]. The keys passed to
+// iter must not be modified.
+func (tr *BTreeBytes) Descend(pivot []byte, iter func(key []byte) bool) {
+	tr.tr.Descend(bstr(pivot), func(key string) bool {
+		return iter(sbytes(key))
+	})
+}
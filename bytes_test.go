@@ -0,0 +1,56 @@
+package tinybtree
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBTreeBytes(t *testing.T) {
+	var tr BTreeBytes
+	keys := randKeys(10_000)
+	buf := make([]byte, 0, 64)
+	for _, key := range keys {
+		buf = append(buf[:0], key...)
+		if tr.SetBytes(buf) {
+			t.Fatal("expected false")
+		}
+	}
+	// the tree must own copies of the inserted keys
+	for i := range buf {
+		buf[i] = 0
+	}
+	for _, key := range keys {
+		buf = append(buf[:0], key...)
+		if !tr.SetBytes(buf) || !tr.GetBytes(buf) {
+			t.Fatal("expected true")
+		}
+	}
+	if tr.Len() != len(keys) {
+		t.Fatalf("expected %v, got %v", len(keys), tr.Len())
+	}
+	var last []byte
+	tr.Scan(func(key []byte) bool {
+		if last != nil && bytes.Compare(last, key) >= 0 {
+			t.Fatal("out of order")
+		}
+		last = key
+		return true
+	})
+	if err := tr.tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		tr.GetBytes(buf)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected 0 allocs, got %v", allocs)
+	}
+	for _, key := range keys {
+		if !tr.DeleteBytes([]byte(key)) {
+			t.Fatal("expected true")
+		}
+	}
+	if tr.Len() != 0 {
+		t.Fatalf("expected 0, got %v", tr.Len())
+	}
+}
@@ -0,0 +1,411 @@
+package tinybtree
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Checked is a debugging aid that wraps a tree and, while checking is
+// enabled, runs every operation against a reference sorted slice too,
+// panicking as soon as the two disagree. Iterations are checked key by key,
+// so a skipped or repeated key is caught where it happens.
+type Checked struct {
+	tr       BTree
+	ref      []string
+	checking bool
+}
+
+// NewChecked returns an empty checked tree with checking enabled.
+func NewChecked() *Checked {
+	return &Checked{checking: true}
+}
+
+// SetChecking turns checking on or off. Turning it on rebuilds the
+// reference from the current contents of the tree.
+func (c *Checked) SetChecking(checking bool) {
+	c.ref = c.ref[:0]
+	if checking {
+		c.tr.Scan(func(key string) bool {
+			c.ref = append(c.ref, key)
+			return true
+		})
+	}
+	c.checking = checking
+}
+
+// Checking returns true if checking is enabled.
+func (c *Checked) Checking() bool {
+	return c.checking
+}
+
+func (c *Checked) search(key string) (index int, found bool) {
+	index = sort.SearchStrings(c.ref, key)
+	return index, index < len(c.ref) && c.ref[index] == key
+}
+
+func (c *Checked) diverged(format string, args ...interface{}) {
+	panic("tinybtree: tree diverged from reference: " +
+		fmt.Sprintf(format, args...))
+}
+
+func (c *Checked) checkLen() {
+	if c.tr.Len() != len(c.ref) {
+		c.diverged("Len() = %d, expected %d", c.tr.Len(), len(c.ref))
+	}
+}
+
+// Set or replace a value for a key
+func (c *Checked) Set(key string) (prev string, replaced bool) {
+	prev, replaced = c.tr.Set(key)
+	if c.checking {
+		i, found := c.search(key)
+		if replaced != found {
+			c.diverged("Set(%q) = %v, expected %v", key, replaced, found)
+		}
+		if found && prev != c.ref[i] {
+			c.diverged("Set(%q) replaced %q, expected %q", key, prev, c.ref[i])
+		}
+		if !found {
+			c.ref = append(c.ref, "")
+			copy(c.ref[i+1:], c.ref[i:])
+			c.ref[i] = key
+		}
+		c.checkLen()
+	}
+	return prev, replaced
+}
+
+// Get a value for key
+func (c *Checked) Get(key string) (gotten bool) {
+	gotten = c.tr.Get(key)
+	if c.checking {
+		if _, found := c.search(key); gotten != found {
+			c.diverged("Get(%q) = %v, expected %v", key, gotten, found)
+		}
+	}
+	return gotten
+}
+
+// Delete a value for a key
+func (c *Checked) Delete(key string) (prev string, deleted bool) {
+	prev, deleted = c.tr.Delete(key)
+	if c.checking {
+		i, found := c.search(key)
+		if deleted != found {
+			c.diverged("Delete(%q) = %v, expected %v", key, deleted, found)
+		}
+		if found && prev != c.ref[i] {
+			c.diverged("Delete(%q) removed %q, expected %q", key, prev, c.ref[i])
+		}
+		if found {
+			c.ref = append(c.ref[:i], c.ref[i+1:]...)
+		}
+		c.checkLen()
+	}
+	return prev, deleted
+}
+
+// Len returns the number of items in the tree
+func (c *Checked) Len() int {
+	return c.tr.Len()
+}
+
+// Scan all items in tree
+func (c *Checked) Scan(iter func(key string) bool) {
+	c.iterate("Scan", c.ref, false, c.tr.Scan, iter)
+}
+
+// iterate runs an iteration over the tree, checking that it yields exactly
+// exp, or exp backwards when reverse is true, unless iter stops it early.
+func (c *Checked) iterate(
+	name string, exp []string, reverse bool,
+	run func(iter func(key string) bool), iter func(key string) bool,
+) {
+	if !c.checking {
+		run(iter)
+		return
+	}
+	exp = append([]string(nil), exp...)
+	if reverse {
+		for i, j := 0, len(exp)-1; i < j; i, j = i+1, j-1 {
+			exp[i], exp[j] = exp[j], exp[i]
+		}
+	}
+	var i int
+	var stopped bool
+	run(func(key string) bool {
+		if i >= len(exp) || exp[i] != key {
+			c.diverged("%s yielded %q at position %d", name, key, i)
+		}
+		i++
+		stopped = !iter(key)
+		return !stopped
+	})
+	if !stopped && i != len(exp) {
+		c.diverged("%s yielded %d keys, expected %d", name, i, len(exp))
+	}
+}
+
+// upper returns the index of the first key in the reference that is
+// greater than key.
+func (c *Checked) upper(key string) int {
+	i, found := c.search(key)
+	if found {
+		i++
+	}
+	return i
+}
+
+// span returns the reference keys from index lo up to hi, or none when hi
+// isn't past lo.
+func (c *Checked) span(lo, hi int) []string {
+	if hi <= lo {
+		return nil
+	}
+	return c.ref[lo:hi]
+}
+
+// Reverse all items in tree
+func (c *Checked) Reverse(iter func(key string) bool) {
+	c.iterate("Reverse", c.ref, true, c.tr.Reverse, iter)
+}
+
+// Ascend the tree within the range [pivot, last]
+func (c *Checked) Ascend(pivot string, iter func(key string) bool) {
+	lo, _ := c.search(pivot)
+	c.iterate(fmt.Sprintf("Ascend(%q)", pivot), c.span(lo, len(c.ref)), false,
+		func(iter func(key string) bool) { c.tr.Ascend(pivot, iter) }, iter)
+}
+
+// Descend the tree within the range [pivot, first]
+func (c *Checked) Descend(pivot string, iter func(key string) bool) {
+	c.iterate(fmt.Sprintf("Descend(%q)", pivot), c.span(0, c.upper(pivot)),
+		true, func(iter func(key string) bool) { c.tr.Descend(pivot, iter) },
+		iter)
+}
+
+// AscendRange ascends the tree within the range [greaterOrEqual, lessThan)
+func (c *Checked) AscendRange(
+	greaterOrEqual, lessThan string,
+	iter func(key string) bool,
+) {
+	lo, _ := c.search(greaterOrEqual)
+	hi, _ := c.search(lessThan)
+	c.iterate(fmt.Sprintf("AscendRange(%q, %q)", greaterOrEqual, lessThan),
+		c.span(lo, hi), false, func(iter func(key string) bool) {
+			c.tr.AscendRange(greaterOrEqual, lessThan, iter)
+		}, iter)
+}
+
+// DescendRange descends the tree within the range
+// (greaterThan, lessOrEqual]
+func (c *Checked) DescendRange(
+	lessOrEqual, greaterThan string,
+	iter func(key string) bool,
+) {
+	c.iterate(fmt.Sprintf("DescendRange(%q, %q)", lessOrEqual, greaterThan),
+		c.span(c.upper(greaterThan), c.upper(lessOrEqual)), true,
+		func(iter func(key string) bool) {
+			c.tr.DescendRange(lessOrEqual, greaterThan, iter)
+		}, iter)
+}
+
+// Min returns the smallest key in the tree
+func (c *Checked) Min() (key string, gotten bool) {
+	key, gotten = c.tr.Min()
+	if c.checking {
+		c.checkEnd("Min", key, gotten, 0)
+	}
+	return key, gotten
+}
+
+// Max returns the largest key in the tree
+func (c *Checked) Max() (key string, gotten bool) {
+	key, gotten = c.tr.Max()
+	if c.checking {
+		c.checkEnd("Max", key, gotten, len(c.ref)-1)
+	}
+	return key, gotten
+}
+
+// PopMin removes and returns the smallest key in the tree
+func (c *Checked) PopMin() (key string, deleted bool) {
+	key, deleted = c.tr.PopMin()
+	if c.checking {
+		c.checkEnd("PopMin", key, deleted, 0)
+		if deleted {
+			c.ref = append(c.ref[:0], c.ref[1:]...)
+		}
+		c.checkLen()
+	}
+	return key, deleted
+}
+
+// PopMax removes and returns the largest key in the tree
+func (c *Checked) PopMax() (key string, deleted bool) {
+	key, deleted = c.tr.PopMax()
+	if c.checking {
+		c.checkEnd("PopMax", key, deleted, len(c.ref)-1)
+		if deleted {
+			c.ref = c.ref[:len(c.ref)-1]
+		}
+		c.checkLen()
+	}
+	return key, deleted
+}
+
+// checkEnd checks the result of an operation on the key at index i of the
+// reference, which is out of range for an empty tree.
+func (c *Checked) checkEnd(name, key string, ok bool, i int) {
+	if ok != (len(c.ref) > 0) {
+		c.diverged("%s() = %v, expected %v", name, ok, len(c.ref) > 0)
+	}
+	if ok && key != c.ref[i] {
+		c.diverged("%s() = %q, expected %q", name, key, c.ref[i])
+	}
+}
+
+// GetAt returns the key at index, where zero is the smallest key.
+func (c *Checked) GetAt(index int) (key string, gotten bool) {
+	key, gotten = c.tr.GetAt(index)
+	if c.checking {
+		exp := index >= 0 && index < len(c.ref)
+		if gotten != exp {
+			c.diverged("GetAt(%d) = %v, expected %v", index, gotten, exp)
+		}
+		if gotten && key != c.ref[index] {
+			c.diverged("GetAt(%d) = %q, expected %q", index, key, c.ref[index])
+		}
+	}
+	return key, gotten
+}
+
+// IndexOf returns the index of key, see BTree.IndexOf
+func (c *Checked) IndexOf(key string) (index int, found bool) {
+	index, found = c.tr.IndexOf(key)
+	if c.checking {
+		i, ok := c.search(key)
+		if index != i || found != ok {
+			c.diverged("IndexOf(%q) = %d, %v, expected %d, %v",
+				key, index, found, i, ok)
+		}
+	}
+	return index, found
+}
+
+// CheckedIterator is an Iterator over a Checked tree that checks every
+// move against the reference.
+type CheckedIterator struct {
+	c      *Checked
+	it     Iterator
+	seeked bool
+	known  bool // pos is known, which it isn't after a failed Seek
+	pos    int  // index of the current key, -1 before the first
+}
+
+// Iter returns a cursor positioned before the first key in the tree.
+func (c *Checked) Iter() CheckedIterator {
+	return CheckedIterator{c: c, it: c.tr.Iter(), known: true, pos: -1}
+}
+
+// move records the position the cursor should have reached and checks
+// the result of the move against it.
+func (ci *CheckedIterator) move(name string, ok bool, pos int) bool {
+	c := ci.c
+	ci.seeked = true
+	ci.pos = pos
+	if !c.checking || !ci.known {
+		return ok
+	}
+	if ci.pos < -1 {
+		ci.pos = -1
+	} else if ci.pos > len(c.ref) {
+		ci.pos = len(c.ref)
+	}
+	exp := ci.pos >= 0 && ci.pos < len(c.ref)
+	if ok != exp {
+		c.diverged("Iterator.%s = %v, expected %v", name, ok, exp)
+	}
+	if ok && ci.it.Key() != c.ref[ci.pos] {
+		c.diverged("Iterator.%s moved to %q, expected %q", name,
+			ci.it.Key(), c.ref[ci.pos])
+	}
+	return ok
+}
+
+// Seek to the first key that is greater than or equal to key.
+func (ci *CheckedIterator) Seek(key string) bool {
+	ok := ci.it.Seek(key)
+	pos, _ := ci.c.search(key)
+	ci.known = true
+	ok = ci.move(fmt.Sprintf("Seek(%q)", key), ok, pos)
+	ci.known = ok
+	return ok
+}
+
+// First moves the cursor to the first key in the tree.
+func (ci *CheckedIterator) First() bool {
+	ci.known = true
+	return ci.move("First()", ci.it.First(), 0)
+}
+
+// Last moves the cursor to the last key in the tree.
+func (ci *CheckedIterator) Last() bool {
+	ci.known = true
+	return ci.move("Last()", ci.it.Last(), len(ci.c.ref)-1)
+}
+
+// Next moves the cursor to the next key. An unpositioned cursor moves to
+// the first key.
+func (ci *CheckedIterator) Next() bool {
+	if !ci.seeked {
+		return ci.First()
+	}
+	return ci.move("Next()", ci.it.Next(), ci.pos+1)
+}
+
+// Prev moves the cursor to the previous key. An unpositioned cursor moves
+// to the last key.
+func (ci *CheckedIterator) Prev() bool {
+	if !ci.seeked {
+		return ci.Last()
+	}
+	return ci.move("Prev()", ci.it.Prev(), ci.pos-1)
+}
+
+// Key returns the key at the current cursor position.
+func (ci *CheckedIterator) Key() string {
+	return ci.it.Key()
+}
+
+// Peek returns the next key without moving the cursor.
+func (ci *CheckedIterator) Peek() (key string, ok bool) {
+	key, ok = ci.it.Peek()
+	c := ci.c
+	if c.checking && ci.known {
+		pos := ci.pos + 1
+		if !ci.seeked {
+			pos = 0
+		}
+		exp := pos >= 0 && pos < len(c.ref)
+		if ok != exp || (ok && key != c.ref[pos]) {
+			c.diverged("Iterator.Peek() = %q, %v, expected position %d",
+				key, ok, pos)
+		}
+	}
+	return key, ok
+}
+
+// SkipTo moves the cursor forward to the first key that is greater than or
+// equal to key.
+func (ci *CheckedIterator) SkipTo(key string) bool {
+	ok := ci.it.SkipTo(key)
+	pos := ci.pos
+	switch {
+	case !ci.seeked || pos < 0:
+		pos, _ = ci.c.search(key)
+	case pos < len(ci.c.ref) && key > ci.c.ref[pos]:
+		pos, _ = ci.c.search(key)
+	}
+	return ci.move(fmt.Sprintf("SkipTo(%q)", key), ok, pos)
+}
@@ -0,0 +1,115 @@
+package tinybtree
+
+import "testing"
+
+func TestChecked(t *testing.T) {
+	c := NewChecked()
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		if _, ok := c.Set(key); ok {
+			t.Fatal("expected false")
+		}
+	}
+	for _, key := range keys[:len(keys)/2] {
+		if _, ok := c.Delete(key); !ok {
+			t.Fatal("expected true")
+		}
+	}
+	for _, key := range keys {
+		c.Get(key)
+	}
+	var n int
+	c.Scan(func(key string) bool {
+		n++
+		return true
+	})
+	if n != len(keys)/2 {
+		t.Fatalf("expected %v, got %v", len(keys)/2, n)
+	}
+
+	// toggling rebuilds the reference from the tree
+	c.SetChecking(false)
+	for _, key := range keys[:100] {
+		c.Set(key)
+	}
+	c.SetChecking(true)
+	if len(c.ref) != c.Len() {
+		t.Fatalf("expected %v, got %v", c.Len(), len(c.ref))
+	}
+
+	// corrupt the tree behind the wrapper's back
+	c.tr.Delete(keys[len(keys)-1])
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	c.Get(keys[len(keys)-1])
+}
+
+func TestCheckedReads(t *testing.T) {
+	c := NewChecked()
+	if _, ok := c.Min(); ok {
+		t.Fatal("expected false")
+	}
+	keys := randKeys(5000)
+	for _, key := range keys {
+		c.Set(key)
+	}
+	all := func(string) bool { return true }
+	for _, key := range append(keys[:20], "", "5", "\xff") {
+		c.Ascend(key, all)
+		c.Descend(key, all)
+		c.AscendRange(key, keys[0], all)
+		c.DescendRange(key, keys[0], all)
+		c.IndexOf(key)
+	}
+	c.Reverse(all)
+	c.Ascend("", func(string) bool { return false })
+	for _, i := range []int{-1, 0, 2500, 4999, 5000} {
+		c.GetAt(i)
+	}
+	c.Min()
+	c.Max()
+	c.PopMin()
+	c.PopMax()
+	if c.Len() != len(keys)-2 {
+		t.Fatalf("expected %v, got %v", len(keys)-2, c.Len())
+	}
+
+	it := c.Iter()
+	var n int
+	for it.Next() {
+		n++
+	}
+	for it.Prev() {
+		n--
+	}
+	if n != 0 {
+		t.Fatalf("expected 0, got %v", n)
+	}
+	it.Seek(keys[0])
+	it.Peek()
+	it.SkipTo(keys[1])
+	it.Seek("\xff")
+	it.Next()
+	it.Last()
+	it.Next()
+	it.Prev()
+
+	// a key missing from the tree is caught by the iterations
+	missing, _ := c.GetAt(10)
+	c.tr.Delete(missing)
+	for _, fn := range []func(){
+		func() { c.Scan(all) },
+		func() { c.Reverse(all) },
+		func() { c.Ascend("", all) },
+		func() {
+			it := c.Iter()
+			for it.Next() {
+			}
+		},
+	} {
+		expectPanic(t, fn)
+	}
+}
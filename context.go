@@ -0,0 +1,104 @@
+package tinybtree
+
+import "context"
+
+// ctxCheckInterval is the number of keys visited between context checks,
+// about one node's worth.
+const ctxCheckInterval = maxItems
+
+// withContext wraps iter so that it stops once ctx is done. The context
+// error is stored in err.
+func withContext(
+	ctx context.Context, iter func(key string) bool, err *error,
+) func(key string) bool {
+	var n int
+	return func(key string) bool {
+		n++
+		if n%ctxCheckInterval == 0 {
+			if *err = ctx.Err(); *err != nil {
+				return false
+			}
+		}
+		return iter(key)
+	}
+}
+
+// ScanCtx is like Scan but stops early with the context error once ctx is
+// done.
+func (tr *BTree) ScanCtx(
+	ctx context.Context, iter func(key string) bool,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	tr.Scan(withContext(ctx, iter, &err))
+	return err
+}
+
+// ReverseCtx is like Reverse but stops early with the context error once
+// ctx is done.
+func (tr *BTree) ReverseCtx(
+	ctx context.Context, iter func(key string) bool,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	tr.Reverse(withContext(ctx, iter, &err))
+	return err
+}
+
+// AscendCtx is like Ascend but stops early with the context error once ctx
+// is done.
+func (tr *BTree) AscendCtx(
+	ctx context.Context, pivot string, iter func(key string) bool,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	tr.Ascend(pivot, withContext(ctx, iter, &err))
+	return err
+}
+
+// DescendCtx is like Descend but stops early with the context error once
+// ctx is done.
+func (tr *BTree) DescendCtx(
+	ctx context.Context, pivot string, iter func(key string) bool,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	tr.Descend(pivot, withContext(ctx, iter, &err))
+	return err
+}
+
+// AscendRangeCtx is like AscendRange but stops early with the context error
+// once ctx is done.
+func (tr *BTree) AscendRangeCtx(
+	ctx context.Context, greaterOrEqual, lessThan string,
+	iter func(key string) bool,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	tr.AscendRange(greaterOrEqual, lessThan, withContext(ctx, iter, &err))
+	return err
+}
+
+// DescendRangeCtx is like DescendRange but stops early with the context
+// error once ctx is done.
+func (tr *BTree) DescendRangeCtx(
+	ctx context.Context, lessOrEqual, greaterThan string,
+	iter func(key string) bool,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	tr.DescendRange(lessOrEqual, greaterThan, withContext(ctx, iter, &err))
+	return err
+}
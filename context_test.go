@@ -0,0 +1,67 @@
+package tinybtree
+
+import (
+	"context"
+	"sort"
+	"testing"
+)
+
+func TestScanCtx(t *testing.T) {
+	var tr BTree
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	sort.Strings(keys)
+	ctx := context.Background()
+	var all []string
+	if err := tr.ScanCtx(ctx, func(key string) bool {
+		all = append(all, key)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !stringsEquals(all, keys) {
+		t.Fatal("mismatch")
+	}
+	var n int
+	if err := tr.AscendRangeCtx(ctx, keys[100], keys[200], func(string) bool {
+		n++
+		return true
+	}); err != nil || n != 100 {
+		t.Fatalf("expected 100/nil, got %v/%v", n, err)
+	}
+
+	// canceled up front
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := tr.DescendCtx(cctx, keys[500], func(string) bool {
+		t.Fatal("should not be reached")
+		return true
+	}); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	// canceled midway
+	cctx, cancel = context.WithCancel(ctx)
+	n = 0
+	err := tr.AscendCtx(cctx, "", func(string) bool {
+		n++
+		if n == 1000 {
+			cancel()
+		}
+		return true
+	})
+	if err != context.Canceled || n < 1000 || n > 1000+ctxCheckInterval {
+		t.Fatalf("expected early cancel, got %v after %v keys", err, n)
+	}
+
+	// stopped by iter
+	n = 0
+	if err := tr.ReverseCtx(ctx, func(string) bool {
+		n++
+		return n < 10
+	}); err != nil || n != 10 {
+		t.Fatalf("expected 10/nil, got %v/%v", n, err)
+	}
+}
@@ -0,0 +1,52 @@
+package tinybtree
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler using the format
+// written by WriteTo, so trees can be embedded in gob-encoded structs.
+func (tr *BTree) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := tr.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, replacing the
+// contents of the tree.
+func (tr *BTree) UnmarshalBinary(data []byte) error {
+	_, err := tr.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// MarshalJSON encodes the tree as a JSON array of keys in ascending order.
+func (tr *BTree) MarshalJSON() ([]byte, error) {
+	keys := make([]string, 0, tr.length)
+	tr.Scan(func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return json.Marshal(keys)
+}
+
+// UnmarshalJSON replaces the contents of the tree with the keys of a JSON
+// array. The keys don't need to be sorted or unique.
+func (tr *BTree) UnmarshalJSON(data []byte) error {
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	sort.Strings(keys)
+	// release the old nodes first, so that the new ones can reuse them
+	tr.clear(true)
+	b := builder{tr: tr}
+	for _, key := range keys {
+		b.append(key)
+	}
+	b.tree()
+	return nil
+}
@@ -0,0 +1,71 @@
+package tinybtree
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+)
+
+type checkpoint struct {
+	Name  string
+	Index *BTree
+}
+
+func TestGob(t *testing.T) {
+	var cp checkpoint
+	cp.Name = "test"
+	cp.Index = new(BTree)
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		cp.Index.Set(key)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&cp); err != nil {
+		t.Fatal(err)
+	}
+	var cp2 checkpoint
+	if err := gob.NewDecoder(&buf).Decode(&cp2); err != nil {
+		t.Fatal(err)
+	}
+	if cp2.Name != cp.Name || cp2.Index.Len() != len(keys) {
+		t.Fatalf("expected %v keys, got %v", len(keys), cp2.Index.Len())
+	}
+	if err := cp2.Index.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp2.Index.UnmarshalBinary([]byte("bad")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var tr BTree
+	data, err := json.Marshal(&tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "[]" {
+		t.Fatalf("expected '[]', got '%s'", data)
+	}
+	for _, key := range []string{"b", "c", "a"} {
+		tr.Set(key)
+	}
+	data, err = json.Marshal(&tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `["a","b","c"]` {
+		t.Fatalf("expected '%s', got '%s'", `["a","b","c"]`, data)
+	}
+	var tr2 BTree
+	if err := json.Unmarshal([]byte(`["z","x","y","x"]`), &tr2); err != nil {
+		t.Fatal(err)
+	}
+	if tr2.Len() != 3 {
+		t.Fatalf("expected 3, got %v", tr2.Len())
+	}
+	if err := tr2.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,32 @@
+package tinybtree
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrFull is returned by TrySet when the node reserve can't cover an
+	// insert.
+	ErrFull = errors.New("tinybtree: node reserve exhausted")
+	// ErrCorrupted is matched by errors.Is for every CorruptedError.
+	ErrCorrupted = errors.New("tinybtree: corrupted data")
+	// ErrInvalidCursor is returned by ScanFrom for a malformed cursor.
+	ErrInvalidCursor = errors.New("tinybtree: invalid cursor")
+)
+
+// CorruptedError is returned when reading data that isn't in the format
+// written by WriteTo.
+type CorruptedError struct {
+	// Offset is the position in the input of the bad record
+	Offset int64
+}
+
+func (e *CorruptedError) Error() string {
+	return fmt.Sprintf("%v at offset %d", ErrCorrupted, e.Offset)
+}
+
+// Unwrap returns ErrCorrupted.
+func (e *CorruptedError) Unwrap() error {
+	return ErrCorrupted
+}
@@ -0,0 +1,20 @@
+package tinybtree
+
+// OnDelete sets fn to be called with every key removed from the tree, by
+// Delete, PopMin, PopMax, DeleteBatch, DeleteRange, DeletePrefix and Clear.
+// It's called after the key is gone and must not modify the tree while a
+// range delete or Clear is reporting keys. Whole tree rebuilds, which are
+// ReadFrom, UnmarshalJSON and MigrateKeys, detach both hooks and report
+// nothing, not even the keys MigrateKeys drops or merges. A nil fn removes
+// the hook.
+func (tr *BTree) OnDelete(fn func(key string)) {
+	tr.onDelete = fn
+}
+
+// OnReplace sets fn to be called when Set, SetHint, SetBatch or TrySet
+// replace an existing key, with the displaced key and the one that took its
+// place. Like OnDelete, it isn't called by whole tree rebuilds. A nil fn
+// removes the hook.
+func (tr *BTree) OnReplace(fn func(prev, key string)) {
+	tr.onReplace = fn
+}
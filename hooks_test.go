@@ -0,0 +1,90 @@
+package tinybtree
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	var tr BTree
+	deleted := make(map[string]int)
+	var replaced []string
+	tr.OnDelete(func(key string) { deleted[key]++ })
+	tr.OnReplace(func(prev, key string) {
+		if prev != key {
+			t.Fatalf("expected '%v', got '%v'", key, prev)
+		}
+		replaced = append(replaced, key)
+	})
+	keys := randKeys(10_000)
+	tr.SetBatch(keys)
+	sort.Strings(keys)
+	tr.SetNX(keys[0])
+	tr.Set(keys[0])
+	tr.TrySet(keys[1])
+	if len(replaced) != 2 || replaced[0] != keys[0] || replaced[1] != keys[1] {
+		t.Fatalf("unexpected replaces %v", replaced)
+	}
+	expect := func(removed []string) {
+		t.Helper()
+		for _, key := range removed {
+			if deleted[key] != 1 {
+				t.Fatalf("'%v' reported %v times", key, deleted[key])
+			}
+			delete(deleted, key)
+		}
+		if len(deleted) != 0 {
+			t.Fatalf("%v unexpected deletes", len(deleted))
+		}
+	}
+	tr.Delete(keys[0])
+	tr.Delete("missing")
+	tr.PopMin()
+	tr.PopMax()
+	expect([]string{keys[0], keys[1], keys[len(keys)-1]})
+	keys = keys[2 : len(keys)-1]
+
+	// range deletes report in ascending order, whether small or large
+	tr.DeleteRange(keys[0], keys[10])
+	expect(keys[:10])
+	keys = keys[10:]
+	tr.DeleteRange(keys[0], keys[len(keys)*3/4])
+	expect(keys[:len(keys)*3/4])
+	keys = keys[len(keys)*3/4:]
+	tr.DeletePrefix("")
+	expect(keys)
+	if tr.Len() != 0 {
+		t.Fatalf("expected 0, got %v", tr.Len())
+	}
+
+	// rebuilds detach the hooks, even for the keys inserted out of order
+	// and those dropped or merged
+	keys = randKeys(1000)
+	tr.SetBatch(keys)
+	tr.MigrateKeys(func(old string) (string, bool) {
+		return old[len(old)-1:] + old[:2], old[0] != '0'
+	}, nil)
+	if len(deleted) != 0 || len(replaced) != 2 {
+		t.Fatal("hooks called by MigrateKeys")
+	}
+	// but stay attached afterwards
+	n := tr.Len()
+	tr.Clear(false)
+	if len(deleted) != n {
+		t.Fatalf("expected %v deletes, got %v", n, len(deleted))
+	}
+	deleted = make(map[string]int)
+	keys = randKeys(1000)
+	tr.SetBatch(keys)
+	tr.Clear(false)
+	expect(keys)
+
+	tr.OnDelete(nil)
+	tr.OnReplace(nil)
+	tr.SetBatch(keys)
+	tr.SetBatch(keys)
+	tr.Clear(true)
+	if len(deleted) != 0 || len(replaced) != 2 {
+		t.Fatal("hooks still called")
+	}
+}
@@ -0,0 +1,395 @@
+package tinybtree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// progressInterval is the number of keys loaded between progress reports.
+const progressInterval = 1 << 16
+
+// LoadWithProgress inserts every key returned by next until it returns
+// false. The progress function, if not nil, is called with the number of
+// keys consumed so far every progressInterval keys and once more at the end.
+func (tr *BTree) LoadWithProgress(
+	next func() (key string, ok bool),
+	progress func(done int),
+) {
+	var done int
+	for {
+		key, ok := next()
+		if !ok {
+			break
+		}
+		tr.Set(key)
+		done++
+		if progress != nil && done%progressInterval == 0 {
+			progress(done)
+		}
+	}
+	if progress != nil && done%progressInterval != 0 {
+		progress(done)
+	}
+}
+
+// builder constructs a tree bottom-up from keys appended in ascending
+// order. Every node but the rightmost on each level is filled to capacity.
+// Nodes are allocated from tr, so a tree with a reserve or a node pool
+// builds from it.
+type builder struct {
+	tr     *BTree
+	levels []*node // the open, rightmost node of each level
+	length int
+	last   string
+}
+
+// append adds the next key. It returns false if key isn't greater than
+// the previously appended key.
+func (b *builder) append(key string) bool {
+	if b.length > 0 && key <= b.last {
+		return false
+	}
+	b.last = key
+	b.length++
+	if len(b.levels) == 0 {
+		b.levels = append(b.levels, b.tr.newNode())
+	}
+	leaf := b.levels[0]
+	if leaf.numItems < maxItems-1 {
+		leaf.items[leaf.numItems] = item{key}
+		leaf.numItems++
+		return true
+	}
+	right := b.tr.newNode()
+	b.push(1, key, right)
+	b.levels[0] = right
+	return true
+}
+
+// push appends a separator key with the child to its right to the open
+// node at height, starting a new node or level when needed.
+func (b *builder) push(height int, key string, right *node) {
+	if height == len(b.levels) {
+		root := b.tr.newBranch()
+		root.children[0] = b.levels[height-1]
+		b.levels = append(b.levels, root)
+	}
+	n := b.levels[height]
+	if n.numItems < maxItems-1 {
+		n.items[n.numItems] = item{key}
+		n.children[n.numItems+1] = right
+		n.numItems++
+		return
+	}
+	next := b.tr.newBranch()
+	next.children[0] = right
+	b.push(height+1, key, next)
+	b.levels[height] = next
+}
+
+// tree moves the built nodes into the tree, replacing its contents.
+func (b *builder) tree() {
+	tr := b.tr
+	tr.root, tr.height, tr.length = nil, 0, 0
+	tr.gen++
+	if b.length == 0 {
+		return
+	}
+	height := len(b.levels) - 1
+	// fill the underfull nodes on the right edge by borrowing from their
+	// left siblings, which are always full.
+	for h := height - 1; h >= 0; h-- {
+		n, parent := b.levels[h], b.levels[h+1]
+		if n.numItems >= minItems {
+			continue
+		}
+		left := parent.children[parent.numItems-1]
+		moveRight(parent, parent.numItems-1, left, n,
+			(left.numItems-n.numItems)/2, h)
+	}
+	b.levels[height].fixCount(height)
+	tr.root, tr.height, tr.length = b.levels[height], height, b.length
+	*b = builder{tr: tr}
+}
+
+// discard hands the nodes built so far back to the tree's reserve or node
+// pool.
+func (b *builder) discard() {
+	if len(b.levels) > 0 && (b.tr.reserved || b.tr.pooled) {
+		height := len(b.levels) - 1
+		b.levels[height].release(b.tr, height)
+	}
+	*b = builder{tr: b.tr}
+}
+
+// moveRight moves k items from left through the separator at parent.items[i]
+// into right, where left and right are the children at i and i+1.
+func moveRight(parent *node, i int, left, right *node, k, height int) {
+	copy(right.items[k:], right.items[:right.numItems])
+	right.items[k-1] = parent.items[i]
+	copy(right.items[:k-1], left.items[left.numItems-k+1:left.numItems])
+	parent.items[i] = left.items[left.numItems-k]
+	for j := left.numItems - k; j < left.numItems; j++ {
+		left.items[j] = item{}
+	}
+	if height > 0 {
+		copy(right.children[k:], right.children[:right.numItems+1])
+		copy(right.children[:k], left.children[left.numItems-k+1:])
+		for j := left.numItems - k + 1; j <= left.numItems; j++ {
+			left.children[j] = nil
+		}
+	}
+	left.numItems -= k
+	right.numItems += k
+}
+
+// moveLeft moves k items from right through the separator at parent.items[i]
+// into left, where left and right are the children at i and i+1.
+func moveLeft(parent *node, i int, left, right *node, k, height int) {
+	left.items[left.numItems] = parent.items[i]
+	copy(left.items[left.numItems+1:], right.items[:k-1])
+	parent.items[i] = right.items[k-1]
+	copy(right.items[:], right.items[k:right.numItems])
+	for j := right.numItems - k; j < right.numItems; j++ {
+		right.items[j] = item{}
+	}
+	if height > 0 {
+		copy(left.children[left.numItems+1:], right.children[:k])
+		copy(right.children[:], right.children[k:right.numItems+1])
+		for j := right.numItems - k + 1; j <= right.numItems; j++ {
+			right.children[j] = nil
+		}
+	}
+	left.numItems += k
+	right.numItems -= k
+}
+
+func (n *node) fixCount(height int) {
+	if height > 0 {
+		for i := 0; i <= n.numItems; i++ {
+			n.children[i].fixCount(height - 1)
+		}
+	}
+	n.count = n.sumCount(height)
+}
+
+// fileMagic starts the binary format written by WriteTo.
+const fileMagic = "TBT\x01"
+
+// WriteTo writes all keys in ascending order to w using a compact binary
+// format, which can be read back with Load or ReadFrom. Each key is stored
+// as the length of the prefix it shares with the previous key followed by
+// the remaining suffix.
+func (tr *BTree) WriteTo(w io.Writer) (n int64, err error) {
+	return tr.writeTo(bufio.NewWriter(w))
+}
+
+// ExportSorted streams all keys in ascending order to w in the format
+// written by WriteTo, holding no more than bufBytes of encoded keys in
+// memory at a time. The keys come from a snapshot taken at the start, see
+// ReadSnapshot, so the Write method of w may modify the tree. A BTree isn't
+// safe for concurrent use, and taking the snapshot writes to the tree, so
+// a writer on another goroutine needs a lock held around the call, or use
+// SafeBTree.ExportSorted instead. The snapshot marks every existing node
+// as shared, so later writes copy the nodes on their path instead of
+// modifying them, and the replaced nodes don't return to the reserve or
+// the node pool.
+func (tr *BTree) ExportSorted(w io.Writer, bufBytes int) (n int64, err error) {
+	s := tr.ReadSnapshot()
+	return s.tr.writeTo(bufio.NewWriterSize(w, bufBytes))
+}
+
+func (tr *BTree) writeTo(bw *bufio.Writer) (n int64, err error) {
+	write := func(p []byte) {
+		if err == nil {
+			var nn int
+			nn, err = bw.Write(p)
+			n += int64(nn)
+		}
+	}
+	var buf [binary.MaxVarintLen64]byte
+	write([]byte(fileMagic))
+	write(buf[:binary.PutUvarint(buf[:], uint64(tr.length))])
+	var prev string
+	tr.Scan(func(key string) bool {
+		shared := 0
+		for shared < len(prev) && shared < len(key) &&
+			prev[shared] == key[shared] {
+			shared++
+		}
+		write(buf[:binary.PutUvarint(buf[:], uint64(shared))])
+		write(buf[:binary.PutUvarint(buf[:], uint64(len(key)-shared))])
+		write([]byte(key[shared:]))
+		prev = key
+		return err == nil
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	return n, err
+}
+
+type countingReader struct {
+	rd *bufio.Reader
+	n  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	c, err := r.rd.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return c, err
+}
+
+// ReadFrom replaces the contents of the tree with keys read from r in the
+// format written by WriteTo. The tree is rebuilt bottom-up, which is much
+// faster than inserting keys one at a time. Malformed data returns a
+// *CorruptedError, and truncated data io.ErrUnexpectedEOF.
+func (tr *BTree) ReadFrom(r io.Reader) (n int64, err error) {
+	rd := &countingReader{rd: bufio.NewReader(r)}
+	b := builder{tr: tr}
+	err = readKeys(rd, &b)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		b.discard()
+		return rd.n, err
+	}
+	tr.clear(true)
+	b.tree()
+	return rd.n, nil
+}
+
+func readKeys(rd *countingReader, b *builder) error {
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(rd, magic); err != nil {
+		return err
+	}
+	if string(magic) != fileMagic {
+		return &CorruptedError{0}
+	}
+	count, err := binary.ReadUvarint(rd)
+	if err != nil {
+		return err
+	}
+	// the key grows as its bytes arrive, so a corrupted length can't
+	// allocate more than the input holds
+	var key bytes.Buffer
+	for i := uint64(0); i < count; i++ {
+		offset := rd.n
+		shared, err := binary.ReadUvarint(rd)
+		if err != nil {
+			return err
+		}
+		size, err := binary.ReadUvarint(rd)
+		if err != nil {
+			return err
+		}
+		if shared > uint64(key.Len()) || size > math.MaxInt32 {
+			return &CorruptedError{offset}
+		}
+		key.Truncate(int(shared))
+		if n, err := io.CopyN(&key, rd, int64(size)); n < int64(size) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if !b.append(key.String()) {
+			return &CorruptedError{offset}
+		}
+	}
+	return nil
+}
+
+// Load returns a new tree with keys read from r in the format written by
+// WriteTo.
+func Load(r io.Reader) (*BTree, error) {
+	tr := new(BTree)
+	if _, err := tr.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// LoadFromReader returns a new tree with the keys read from r, where each
+// key is terminated by delim, such as '\n' or 0. The final key may omit the
+// delimiter. The keys must be in strictly ascending order; the tree is built
+// bottom-up as they're read, so only the tree itself is held in memory. A
+// key that's out of order returns a *CorruptedError.
+func LoadFromReader(r io.Reader, delim byte) (*BTree, error) {
+	rd := bufio.NewReader(r)
+	tr := new(BTree)
+	b := builder{tr: tr}
+	var offset int64
+	for {
+		key, err := rd.ReadString(delim)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(key) == 0 {
+			break
+		}
+		n := len(key)
+		if key[n-1] == delim {
+			key = key[:n-1]
+		}
+		if !b.append(key) {
+			return nil, &CorruptedError{offset}
+		}
+		offset += int64(n)
+		if err == io.EOF {
+			break
+		}
+	}
+	b.tree()
+	return tr, nil
+}
+
+// MigrateKeys rewrites every key in the tree with fn, dropping keys for
+// which fn returns false, and rebuilds the tree in a single pass. Keys that
+// fn maps to the same new key are merged. When fn preserves the key order
+// the new tree is built bottom-up as keys stream through; keys that come
+// out of order are inserted afterwards. The progress function, if not nil,
+// is called like it is for LoadWithProgress. The OnDelete and OnReplace
+// hooks are detached for the whole rebuild, so neither dropped nor merged
+// keys are reported.
+func (tr *BTree) MigrateKeys(
+	fn func(old string) (new string, keep bool),
+	progress func(done int),
+) {
+	onDelete, onReplace := tr.onDelete, tr.onReplace
+	tr.onDelete, tr.onReplace = nil, nil
+	defer func() { tr.onDelete, tr.onReplace = onDelete, onReplace }()
+	b := builder{tr: tr}
+	var rest []string
+	var done int
+	tr.Scan(func(key string) bool {
+		key, keep := fn(key)
+		if keep && !b.append(key) && key != b.last {
+			rest = append(rest, key)
+		}
+		done++
+		if progress != nil && done%progressInterval == 0 {
+			progress(done)
+		}
+		return true
+	})
+	tr.clear(true)
+	b.tree()
+	tr.SetBatch(rest)
+	if progress != nil && done%progressInterval != 0 {
+		progress(done)
+	}
+}
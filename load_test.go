@@ -0,0 +1,274 @@
+package tinybtree
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLoadWithProgress(t *testing.T) {
+	var tr BTree
+	keys := randKeys(progressInterval*2 + 10)
+	var i int
+	var reports []int
+	tr.LoadWithProgress(func() (string, bool) {
+		if i == len(keys) {
+			return "", false
+		}
+		i++
+		return keys[i-1], true
+	}, func(done int) {
+		reports = append(reports, done)
+	})
+	if tr.Len() != len(keys) {
+		t.Fatalf("expected %v, got %v", len(keys), tr.Len())
+	}
+	exp := []int{progressInterval, progressInterval * 2, len(keys)}
+	if len(reports) != len(exp) {
+		t.Fatalf("expected %v, got %v", exp, reports)
+	}
+	for i := range exp {
+		if reports[i] != exp[i] {
+			t.Fatalf("expected %v, got %v", exp, reports)
+		}
+	}
+}
+
+func (n *node) checkFill(t *testing.T, height int, root bool) {
+	if !root && (n.numItems < minItems || n.numItems >= maxItems) {
+		t.Fatalf("bad fill %v", n.numItems)
+	}
+	if height > 0 {
+		for i := 0; i <= n.numItems; i++ {
+			n.children[i].checkFill(t, height-1, false)
+		}
+	}
+}
+
+func TestWriteToLoad(t *testing.T) {
+	for _, N := range []int{0, 1, 2, 253, 254, 255, 256, 1000,
+		254*255 + 253, 254*255 + 254, 254*255 + 255, 100_000} {
+		var tr BTree
+		keys := randKeys(N)
+		for _, key := range keys {
+			tr.Set(key)
+		}
+		var buf bytes.Buffer
+		n, err := tr.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(buf.Len()) {
+			t.Fatalf("expected %v, got %v", buf.Len(), n)
+		}
+		tr2, err := Load(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tr2.Len() != N {
+			t.Fatalf("expected %v, got %v", N, tr2.Len())
+		}
+		if N == 0 {
+			continue
+		}
+		tr2.root.checkFill(t, tr2.height, true)
+		tr2.root.checkCounts(t, tr2.height)
+		sort.Strings(keys)
+		var all []string
+		tr2.Scan(func(key string) bool {
+			all = append(all, key)
+			return true
+		})
+		if !stringsEquals(keys, all) {
+			t.Fatal("mismatch")
+		}
+		for _, i := range rand.Perm(N) {
+			if _, ok := tr2.Delete(keys[i]); !ok {
+				t.Fatal("expected true")
+			}
+		}
+		if tr2.Len() != 0 {
+			t.Fatalf("expected 0, got %v", tr2.Len())
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	var tr BTree
+	for _, key := range randKeys(1000) {
+		tr.Set(key)
+	}
+	var buf bytes.Buffer
+	tr.WriteTo(&buf)
+	data := buf.Bytes()
+	if _, err := Load(bytes.NewReader(data[:len(data)-1])); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected '%v', got '%v'", io.ErrUnexpectedEOF, err)
+	}
+	if _, err := Load(bytes.NewReader([]byte("nope"))); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected '%v', got '%v'", ErrCorrupted, err)
+	}
+	// keys out of order
+	bad := []byte(fileMagic + "\x02\x00\x01b\x00\x01a")
+	_, err := Load(bytes.NewReader(bad))
+	var cerr *CorruptedError
+	if !errors.As(err, &cerr) || cerr.Offset != 8 {
+		t.Fatalf("expected corrupted at offset 8, got '%v'", err)
+	}
+	// a huge suffix length on a short input fails without allocating it
+	huge := []byte(fileMagic + "\x01\x00\xff\xff\xff\xff\x07ab")
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = Load(bytes.NewReader(huge))
+	runtime.ReadMemStats(&after)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected '%v', got '%v'", io.ErrUnexpectedEOF, err)
+	}
+	if d := after.TotalAlloc - before.TotalAlloc; d >= 1<<20 {
+		t.Fatalf("allocated %v bytes", d)
+	}
+}
+
+type limitWriter struct {
+	max   int
+	buf   bytes.Buffer
+	large bool
+	write func() // called on every write, if not nil
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		w.large = true
+	}
+	if w.write != nil {
+		w.write()
+	}
+	return w.buf.Write(p)
+}
+
+func TestExportSorted(t *testing.T) {
+	var tr BTree
+	keys := randKeys(100_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	w := &limitWriter{max: 1024}
+	if _, err := tr.ExportSorted(w, 1024); err != nil {
+		t.Fatal(err)
+	}
+	if w.large {
+		t.Fatal("write exceeded buffer size")
+	}
+	tr2, err := Load(&w.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr2.Len() != len(keys) {
+		t.Fatalf("expected %v, got %v", len(keys), tr2.Len())
+	}
+
+	// the export sees the keys as they were when it started
+	for _, export := range []func(w io.Writer) (int64, error){
+		func(w io.Writer) (int64, error) { return tr.ExportSorted(w, 1024) },
+		func(w io.Writer) (int64, error) {
+			s := NewSafe()
+			for _, key := range keys {
+				s.Set(key)
+			}
+			w.(*limitWriter).write = func() { s.PopMin() }
+			return s.ExportSorted(w, 1024)
+		},
+	} {
+		w := &limitWriter{max: 1024, write: func() { tr.PopMin() }}
+		if _, err := export(w); err != nil {
+			t.Fatal(err)
+		}
+		tr2, err := Load(&w.buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tr2.Len() != len(keys) {
+			t.Fatalf("expected %v, got %v", len(keys), tr2.Len())
+		}
+	}
+}
+
+func TestMigrateKeys(t *testing.T) {
+	var tr BTree
+	keys := randKeys(100_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	// order preserving, dropping odd keys
+	var reports int
+	tr.MigrateKeys(func(old string) (string, bool) {
+		return "k:" + old, old[len(old)-1]%2 == 0
+	}, func(done int) {
+		reports++
+	})
+	if reports != 2 {
+		t.Fatalf("expected 2, got %v", reports)
+	}
+	if tr.Len() != len(keys)/2 {
+		t.Fatalf("expected %v, got %v", len(keys)/2, tr.Len())
+	}
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !tr.Get("k:" + strings.Repeat("0", 5)) {
+		t.Fatal("expected true")
+	}
+	// order reversing and merging
+	tr.MigrateKeys(func(old string) (string, bool) {
+		var rev []byte
+		for i := len(old) - 1; i >= 0; i-- {
+			rev = append(rev, old[i])
+		}
+		return string(rev[1:]), true
+	}, nil)
+	if tr.Len() != len(keys)/10 {
+		t.Fatalf("expected %v, got %v", len(keys)/10, tr.Len())
+	}
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadFromReader(t *testing.T) {
+	for _, N := range []int{0, 1, 254, 1000, 100_000} {
+		keys := randKeys(N)
+		sort.Strings(keys)
+		for _, delim := range []byte{'\n', 0} {
+			data := strings.Join(keys, string(delim))
+			for _, trailing := range []bool{false, true} {
+				if trailing && N > 0 {
+					data += string(delim)
+				}
+				tr, err := LoadFromReader(strings.NewReader(data), delim)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := tr.Validate(); err != nil {
+					t.Fatal(err)
+				}
+				var all []string
+				tr.Scan(func(key string) bool {
+					all = append(all, key)
+					return true
+				})
+				if !stringsEquals(all, keys) {
+					t.Fatalf("mismatch for %v keys", N)
+				}
+			}
+		}
+	}
+	_, err := LoadFromReader(strings.NewReader("a\nc\nb\n"), '\n')
+	var cerr *CorruptedError
+	if !errors.As(err, &cerr) || cerr.Offset != 4 {
+		t.Fatalf("expected corrupted at offset 4, got '%v'", err)
+	}
+}
@@ -0,0 +1,79 @@
+package tinybtree
+
+// Map is an ordered map from string keys to values, with methods named
+// after sync.Map. The keys are kept in a BTree and the values in a Go map.
+// The zero value is an empty map. Map is not safe for concurrent use.
+type Map struct {
+	tr     BTree
+	values map[string]interface{}
+}
+
+// Load returns the value stored for key, and whether it was found.
+func (m *Map) Load(key string) (value interface{}, ok bool) {
+	value, ok = m.values[key]
+	return value, ok
+}
+
+// Store sets the value for key.
+func (m *Map) Store(key string, value interface{}) {
+	if m.values == nil {
+		m.values = make(map[string]interface{})
+	}
+	if _, ok := m.values[key]; !ok {
+		m.tr.Set(key)
+	}
+	m.values[key] = value
+}
+
+// LoadOrStore returns the existing value for key if present. Otherwise it
+// stores and returns value. The loaded result is true if the value was
+// loaded, false if stored.
+func (m *Map) LoadOrStore(key string, value interface{}) (
+	actual interface{}, loaded bool,
+) {
+	if actual, loaded = m.values[key]; loaded {
+		return actual, true
+	}
+	m.Store(key, value)
+	return value, false
+}
+
+// LoadAndDelete deletes the value for key, returning the previous value if
+// any. The loaded result reports whether the key was present.
+func (m *Map) LoadAndDelete(key string) (value interface{}, loaded bool) {
+	if value, loaded = m.values[key]; loaded {
+		m.tr.Delete(key)
+		delete(m.values, key)
+	}
+	return value, loaded
+}
+
+// Delete deletes the value for key.
+func (m *Map) Delete(key string) {
+	m.LoadAndDelete(key)
+}
+
+// Range calls f for each key and value in ascending key order. If f
+// returns false, range stops the iteration. f may Store to existing keys,
+// but adding or deleting keys during Range panics.
+func (m *Map) Range(f func(key string, value interface{}) bool) {
+	m.tr.Scan(func(key string) bool {
+		return f(key, m.values[key])
+	})
+}
+
+// AscendRange calls f for each key and value within the range
+// [greaterOrEqual, lessThan), in ascending key order.
+func (m *Map) AscendRange(
+	greaterOrEqual, lessThan string,
+	f func(key string, value interface{}) bool,
+) {
+	m.tr.AscendRange(greaterOrEqual, lessThan, func(key string) bool {
+		return f(key, m.values[key])
+	})
+}
+
+// Len returns the number of keys in the map
+func (m *Map) Len() int {
+	return m.tr.Len()
+}
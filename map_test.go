@@ -0,0 +1,75 @@
+package tinybtree
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	var m Map
+	if _, ok := m.Load("a"); ok {
+		t.Fatal("expected false")
+	}
+	keys := randKeys(10_000)
+	for i, key := range keys {
+		m.Store(key, i)
+	}
+	for i, key := range keys {
+		if v, ok := m.Load(key); !ok || v != i {
+			t.Fatalf("expected %v/true, got %v/%v", i, v, ok)
+		}
+	}
+	if m.Len() != len(keys) {
+		t.Fatalf("expected %v, got %v", len(keys), m.Len())
+	}
+	if v, loaded := m.LoadOrStore(keys[0], -1); !loaded || v != 0 {
+		t.Fatalf("expected 0/true, got %v/%v", v, loaded)
+	}
+	if v, loaded := m.LoadOrStore("new", -1); loaded || v != -1 {
+		t.Fatalf("expected -1/false, got %v/%v", v, loaded)
+	}
+	if v, loaded := m.LoadAndDelete("new"); !loaded || v != -1 {
+		t.Fatalf("expected -1/true, got %v/%v", v, loaded)
+	}
+	if _, loaded := m.LoadAndDelete("new"); loaded {
+		t.Fatal("expected false")
+	}
+
+	// range in order, storing to existing keys
+	index := make(map[string]int)
+	for i, key := range keys {
+		index[key] = i
+	}
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	var n int
+	m.Range(func(key string, value interface{}) bool {
+		if key != sorted[n] || value != index[key] {
+			t.Fatalf("expected %v/%v, got %v/%v", sorted[n], index[key],
+				key, value)
+		}
+		m.Store(key, value.(int)+1)
+		n++
+		return true
+	})
+	if n != len(keys) {
+		t.Fatalf("expected %v, got %v", len(keys), n)
+	}
+	if v, _ := m.Load(keys[5]); v != 6 {
+		t.Fatalf("expected 6, got %v", v)
+	}
+	n = 0
+	m.AscendRange(sorted[10], sorted[20], func(key string, _ interface{}) bool {
+		n++
+		return true
+	})
+	if n != 10 {
+		t.Fatalf("expected 10, got %v", n)
+	}
+	expectPanic(t, func() {
+		m.Range(func(key string, value interface{}) bool {
+			m.Delete(key)
+			return true
+		})
+	})
+}
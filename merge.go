@@ -0,0 +1,59 @@
+package tinybtree
+
+import "container/heap"
+
+// mergeHeap orders iterators by their current key, breaking ties by the
+// position of their tree in the input.
+type mergeHeap []mergeIter
+
+type mergeIter struct {
+	iter  Iterator
+	index int
+}
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	a, b := h[i].iter.Key(), h[j].iter.Key()
+	return a < b || (a == b && h[i].index < h[j].index)
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeIter)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// MergeScan iterates over the keys of all trees in ascending order, as if
+// they were one tree. When dedupe is true a key held by several trees is
+// passed to iter only once, otherwise once per tree. Nil trees are skipped.
+func MergeScan(trees []*BTree, dedupe bool, iter func(key string) bool) {
+	h := make(mergeHeap, 0, len(trees))
+	for i, tr := range trees {
+		if tr == nil {
+			continue
+		}
+		it := tr.Iter()
+		if it.First() {
+			h = append(h, mergeIter{it, i})
+		}
+	}
+	heap.Init(&h)
+	var last string
+	var started bool
+	for len(h) > 0 {
+		key := h[0].iter.Key()
+		if !dedupe || !started || key != last {
+			if !iter(key) {
+				return
+			}
+			last, started = key, true
+		}
+		if h[0].iter.Next() {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package tinybtree
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestMergeScan(t *testing.T) {
+	MergeScan(nil, true, func(key string) bool {
+		t.Fatal("should not be reached")
+		return true
+	})
+	keys := randKeys(10_000)
+	trees := make([]*BTree, 4)
+	for i := range trees {
+		trees[i] = new(BTree)
+	}
+	var dups []string
+	for i, key := range keys {
+		trees[i%len(trees)].Set(key)
+		dups = append(dups, key)
+		if i%3 == 0 {
+			// also in the next tree
+			trees[(i+1)%len(trees)].Set(key)
+			dups = append(dups, key)
+		}
+	}
+	trees = append(trees, nil, new(BTree))
+	sort.Strings(keys)
+	sort.Strings(dups)
+	var all []string
+	MergeScan(trees, true, func(key string) bool {
+		all = append(all, key)
+		return true
+	})
+	if !stringsEquals(keys, all) {
+		t.Fatal("mismatch")
+	}
+	all = all[:0]
+	MergeScan(trees, false, func(key string) bool {
+		all = append(all, key)
+		return true
+	})
+	if !stringsEquals(dups, all) {
+		t.Fatal("mismatch")
+	}
+	var count int
+	MergeScan(trees, true, Limit(10, func(key string) bool {
+		count++
+		return true
+	}))
+	if count != 10 {
+		t.Fatalf("expected 10, got %v", count)
+	}
+}
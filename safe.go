@@ -0,0 +1,210 @@
+package tinybtree
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// SafeBTree is a BTree that is safe for concurrent use. Reads share a
+// read lock and writes take the write lock. Iteration holds the read lock
+// until the iterator returns, so it sees a consistent view of the tree. The
+// iterator must not call any method of the same tree, not even a read: a
+// write takes the lock it already holds, and a read takes the read lock
+// recursively, which deadlocks as soon as a writer is waiting for it.
+type SafeBTree struct {
+	mu sync.RWMutex
+	tr BTree
+}
+
+// NewSafe returns an empty tree that is safe for concurrent use.
+func NewSafe() *SafeBTree {
+	return new(SafeBTree)
+}
+
+// Set or replace a value for a key
+func (s *SafeBTree) Set(key string) (prev string, replaced bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tr.Set(key)
+}
+
+// SetNX inserts key only if it isn't already in the tree
+func (s *SafeBTree) SetNX(key string) (inserted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tr.SetNX(key)
+}
+
+// Get a value for key
+func (s *SafeBTree) Get(key string) (gotten bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tr.Get(key)
+}
+
+// Delete a value for a key
+func (s *SafeBTree) Delete(key string) (prev string, deleted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tr.Delete(key)
+}
+
+// DeleteRange deletes all keys within the range [greaterOrEqual, lessThan)
+func (s *SafeBTree) DeleteRange(greaterOrEqual, lessThan string) (deleted int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tr.DeleteRange(greaterOrEqual, lessThan)
+}
+
+// Len returns the number of items in the tree
+func (s *SafeBTree) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tr.Len()
+}
+
+// Min returns the smallest key in the tree
+func (s *SafeBTree) Min() (key string, gotten bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tr.Min()
+}
+
+// Max returns the largest key in the tree
+func (s *SafeBTree) Max() (key string, gotten bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tr.Max()
+}
+
+// PopMin removes and returns the smallest key in the tree
+func (s *SafeBTree) PopMin() (key string, deleted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tr.PopMin()
+}
+
+// PopMax removes and returns the largest key in the tree
+func (s *SafeBTree) PopMax() (key string, deleted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tr.PopMax()
+}
+
+// GetAt returns the key at index, where zero is the smallest key
+func (s *SafeBTree) GetAt(index int) (key string, gotten bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tr.GetAt(index)
+}
+
+// IndexOf returns the index of key
+func (s *SafeBTree) IndexOf(key string) (index int, found bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tr.IndexOf(key)
+}
+
+// Scan all items in tree
+func (s *SafeBTree) Scan(iter func(key string) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.tr.Scan(iter)
+}
+
+// Reverse all items in tree
+func (s *SafeBTree) Reverse(iter func(key string) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.tr.Reverse(iter)
+}
+
+// Ascend the tree within the range [pivot, last]
+func (s *SafeBTree) Ascend(pivot string, iter func(key string) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.tr.Ascend(pivot, iter)
+}
+
+// Descend the tree within the range [pivot, first]
+func (s *SafeBTree) Descend(pivot string, iter func(key string) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.tr.Descend(pivot, iter)
+}
+
+// AscendRange ascends the tree within the range [greaterOrEqual, lessThan)
+func (s *SafeBTree) AscendRange(
+	greaterOrEqual, lessThan string,
+	iter func(key string) bool,
+) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.tr.AscendRange(greaterOrEqual, lessThan, iter)
+}
+
+// DescendRange descends the tree within the range (greaterThan, lessOrEqual]
+func (s *SafeBTree) DescendRange(
+	lessOrEqual, greaterThan string,
+	iter func(key string) bool,
+) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.tr.DescendRange(lessOrEqual, greaterThan, iter)
+}
+
+// WriteTo writes all keys in ascending order to w, see BTree.WriteTo
+func (s *SafeBTree) WriteTo(w io.Writer) (n int64, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tr.WriteTo(w)
+}
+
+// ExportSorted streams all keys in ascending order to w, see
+// BTree.ExportSorted. The lock is only held while the snapshot is taken, so
+// writers aren't blocked by a slow w, though they copy the nodes they
+// modify from then on.
+func (s *SafeBTree) ExportSorted(w io.Writer, bufBytes int) (
+	n int64, err error,
+) {
+	s.mu.Lock()
+	snap := s.tr.ReadSnapshot()
+	s.mu.Unlock()
+	return snap.tr.writeTo(bufio.NewWriterSize(w, bufBytes))
+}
+
+// ReadFrom replaces the contents of the tree with keys read from r, see
+// BTree.ReadFrom
+func (s *SafeBTree) ReadFrom(r io.Reader) (n int64, err error) {
+	var tr BTree
+	n, err = tr.ReadFrom(r)
+	if err != nil {
+		return n, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tr.clear(true)
+	if tr.root != nil && s.tr.isoid != tr.isoid {
+		// hand the nodes to the tree so that it modifies them in place
+		tr.root.own(s.tr.isoid, tr.height)
+	}
+	s.tr.root, s.tr.height, s.tr.length = tr.root, tr.height, tr.length
+	return n, nil
+}
+
+// OnDelete sets the delete hook, see BTree.OnDelete. The hook runs with
+// the write lock held and must not call back into the tree.
+func (s *SafeBTree) OnDelete(fn func(key string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tr.OnDelete(fn)
+}
+
+// OnReplace sets the replace hook, see BTree.OnReplace. The hook runs with
+// the write lock held and must not call back into the tree.
+func (s *SafeBTree) OnReplace(fn func(prev, key string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tr.OnReplace(fn)
+}
@@ -0,0 +1,69 @@
+package tinybtree
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestSafeBTree(t *testing.T) {
+	tr := NewSafe()
+	keys := randKeys(10_000)
+	T := runtime.NumCPU()
+	var wg sync.WaitGroup
+	wg.Add(T * 2)
+	for i := 0; i < T; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := i; j < len(keys); j += T {
+				tr.Set(keys[j])
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for _, key := range keys {
+				tr.Get(key)
+			}
+			var last string
+			tr.Scan(func(key string) bool {
+				if key <= last {
+					t.Error("out of order")
+					return false
+				}
+				last = key
+				return true
+			})
+		}()
+	}
+	wg.Wait()
+	if tr.Len() != len(keys) {
+		t.Fatalf("expected %v, got %v", len(keys), tr.Len())
+	}
+	var buf bytes.Buffer
+	if _, err := tr.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tr2 := NewSafe()
+	if _, err := tr2.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if tr2.Len() != len(keys) {
+		t.Fatalf("expected %v, got %v", len(keys), tr2.Len())
+	}
+	wg.Add(T)
+	for i := 0; i < T; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := i; j < len(keys); j += T {
+				if _, ok := tr.Delete(keys[j]); !ok {
+					t.Error("expected true")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if tr.Len() != 0 {
+		t.Fatalf("expected 0, got %v", tr.Len())
+	}
+}
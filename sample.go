@@ -0,0 +1,56 @@
+package tinybtree
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// Sample returns n keys picked uniformly at random without replacement, in
+// ascending order. All keys are returned when n is at least Len. Each key
+// is found through the subtree counts in O(log n), so sampling doesn't
+// depend on the size of the tree. A nil r uses the default source.
+func (tr *BTree) Sample(n int, r *rand.Rand) []string {
+	if n <= 0 || tr.length == 0 {
+		return nil
+	}
+	if n > tr.length {
+		n = tr.length
+	}
+	intn := rand.Intn
+	if r != nil {
+		intn = r.Intn
+	}
+	// Floyd's algorithm picks n distinct indexes in O(n).
+	picked := make(map[int]bool, n)
+	indexes := make([]int, 0, n)
+	for j := tr.length - n; j < tr.length; j++ {
+		i := intn(j + 1)
+		if picked[i] {
+			i = j
+		}
+		picked[i] = true
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	keys := make([]string, n)
+	for k, i := range indexes {
+		keys[k], _ = tr.GetAt(i)
+	}
+	return keys
+}
+
+// Quantile returns the key at fraction q of the way through the tree,
+// where 0 is the smallest key and 1 the largest. It's exact and runs in
+// O(log n). An empty tree returns "".
+func (tr *BTree) Quantile(q float64) string {
+	if tr.length == 0 {
+		return ""
+	}
+	if q < 0 {
+		q = 0
+	} else if q > 1 {
+		q = 1
+	}
+	key, _ := tr.GetAt(int(q * float64(tr.length-1)))
+	return key
+}
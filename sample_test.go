@@ -0,0 +1,71 @@
+package tinybtree
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSample(t *testing.T) {
+	var tr BTree
+	if keys := tr.Sample(10, nil); keys != nil {
+		t.Fatalf("expected nil, got %v", keys)
+	}
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	sort.Strings(keys)
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 10, 5000, 10_000, 20_000} {
+		sample := tr.Sample(n, r)
+		exp := n
+		if exp > len(keys) {
+			exp = len(keys)
+		}
+		if len(sample) != exp {
+			t.Fatalf("expected %v, got %v", exp, len(sample))
+		}
+		for i, key := range sample {
+			if i > 0 && key <= sample[i-1] {
+				t.Fatal("out of order or repeated")
+			}
+			if !tr.Get(key) {
+				t.Fatalf("'%v' not in tree", key)
+			}
+		}
+	}
+	// every key is about equally likely
+	hits := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		for _, key := range tr.Sample(100, r) {
+			hits[key]++
+		}
+	}
+	if len(hits) < len(keys)*9/10 {
+		t.Fatalf("only %v of %v keys sampled", len(hits), len(keys))
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	var tr BTree
+	if q := tr.Quantile(0.5); q != "" {
+		t.Fatalf("expected '', got '%v'", q)
+	}
+	keys := randKeys(10_001)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	sort.Strings(keys)
+	for _, c := range []struct {
+		q   float64
+		exp string
+	}{
+		{-1, keys[0]}, {0, keys[0]}, {0.5, keys[5000]}, {0.25, keys[2500]},
+		{1, keys[10_000]}, {2, keys[10_000]},
+	} {
+		if q := tr.Quantile(c.q); q != c.exp {
+			t.Fatalf("Quantile(%v): expected '%v', got '%v'", c.q, c.exp, q)
+		}
+	}
+}
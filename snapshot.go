@@ -0,0 +1,126 @@
+package tinybtree
+
+// Snapshot is a read-only view of a tree as it was when ReadSnapshot was
+// called. It shares its nodes with the tree, which copies a node before
+// modifying it once it's shared. A Snapshot never changes, so any number
+// of goroutines may read it without locking, even while the tree it came
+// from is being modified.
+type Snapshot struct {
+	tr BTree
+}
+
+// ReadSnapshot returns a read-only view of the tree in O(1). Modifications
+// to the tree after the call copy the nodes on their path instead of
+// changing them in place, so a writer that publishes each new snapshot
+// through an atomic pointer gives its readers lock-free access.
+func (tr *BTree) ReadSnapshot() *Snapshot {
+	s := &Snapshot{tr: BTree{
+		root: tr.root, height: tr.height, length: tr.length,
+		isoid: tr.isoid,
+	}}
+	tr.isoid++
+	return s
+}
+
+// Get a value for key
+func (s *Snapshot) Get(key string) (gotten bool) {
+	return s.tr.Get(key)
+}
+
+// Len returns the number of items in the snapshot
+func (s *Snapshot) Len() int {
+	return s.tr.Len()
+}
+
+// Min returns the smallest key in the snapshot
+func (s *Snapshot) Min() (key string, gotten bool) {
+	return s.tr.Min()
+}
+
+// Max returns the largest key in the snapshot
+func (s *Snapshot) Max() (key string, gotten bool) {
+	return s.tr.Max()
+}
+
+// Floor returns the greatest key that is less than or equal to key.
+func (s *Snapshot) Floor(key string) (floor string, gotten bool) {
+	return s.tr.Floor(key)
+}
+
+// Ceiling returns the smallest key that is greater than or equal to key.
+func (s *Snapshot) Ceiling(key string) (ceiling string, gotten bool) {
+	return s.tr.Ceiling(key)
+}
+
+// GetAt returns the key at index, where zero is the smallest key.
+func (s *Snapshot) GetAt(index int) (key string, gotten bool) {
+	return s.tr.GetAt(index)
+}
+
+// IndexOf returns the index of key, see BTree.IndexOf
+func (s *Snapshot) IndexOf(key string) (index int, found bool) {
+	return s.tr.IndexOf(key)
+}
+
+// CountRange returns the number of keys within the range
+// [greaterOrEqual, lessThan)
+func (s *Snapshot) CountRange(greaterOrEqual, lessThan string) int {
+	return s.tr.CountRange(greaterOrEqual, lessThan)
+}
+
+// Scan all items in the snapshot
+func (s *Snapshot) Scan(iter func(key string) bool) {
+	s.tr.Scan(iter)
+}
+
+// Reverse all items in the snapshot
+func (s *Snapshot) Reverse(iter func(key string) bool) {
+	s.tr.Reverse(iter)
+}
+
+// Ascend the snapshot within the range [pivot, last]
+func (s *Snapshot) Ascend(pivot string, iter func(key string) bool) {
+	s.tr.Ascend(pivot, iter)
+}
+
+// Descend the snapshot within the range [pivot, first]
+func (s *Snapshot) Descend(pivot string, iter func(key string) bool) {
+	s.tr.Descend(pivot, iter)
+}
+
+// AscendRange ascends the snapshot within the range
+// [greaterOrEqual, lessThan)
+func (s *Snapshot) AscendRange(
+	greaterOrEqual, lessThan string,
+	iter func(key string) bool,
+) {
+	s.tr.AscendRange(greaterOrEqual, lessThan, iter)
+}
+
+// DescendRange descends the snapshot within the range
+// (greaterThan, lessOrEqual]
+func (s *Snapshot) DescendRange(
+	lessOrEqual, greaterThan string,
+	iter func(key string) bool,
+) {
+	s.tr.DescendRange(lessOrEqual, greaterThan, iter)
+}
+
+// Equal returns true if the snapshot and tr hold the same keys, see
+// BTree.Equal. Comparing a snapshot with the tree it came from skips the
+// nodes they still share, so it costs about as much as the changes made
+// since the snapshot was taken.
+func (s *Snapshot) Equal(tr *BTree) bool {
+	return s.tr.Equal(tr)
+}
+
+// Compare compares the keys of the snapshot with those of tr, see
+// BTree.Compare. Like Equal, it skips the nodes they still share.
+func (s *Snapshot) Compare(tr *BTree) int {
+	return s.tr.Compare(tr)
+}
+
+// Iter returns a cursor positioned before the first key in the snapshot.
+func (s *Snapshot) Iter() Iterator {
+	return s.tr.Iter()
+}
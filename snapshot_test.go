@@ -0,0 +1,146 @@
+package tinybtree
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func snapshotKeys(s *Snapshot) []string {
+	var keys []string
+	s.Scan(func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func TestReadSnapshot(t *testing.T) {
+	for _, mode := range []string{"plain", "pooled", "reserved"} {
+		var tr BTree
+		switch mode {
+		case "pooled":
+			tr.UseNodePool(true)
+		case "reserved":
+			tr.Reserve(1000)
+		}
+		keys := randKeys(50_000)
+		for _, key := range keys[:len(keys)/2] {
+			tr.Set(key)
+		}
+		type snap struct {
+			s    *Snapshot
+			keys []string
+		}
+		var snaps []snap
+		take := func() {
+			s := tr.ReadSnapshot()
+			expect := append([]string(nil), snapshotKeys(s)...)
+			snaps = append(snaps, snap{s, expect})
+		}
+		take()
+		for i, key := range keys[len(keys)/2:] {
+			tr.Set(key)
+			tr.Delete(keys[i])
+			if i%5000 == 0 {
+				take()
+			}
+		}
+		take()
+		tr.PopMin()
+		tr.PopMax()
+		tr.DeleteRange(keys[0][:1], keys[1][:1])
+		take()
+		tr.Clear(true)
+		for _, key := range keys[:1000] {
+			tr.Set(key)
+		}
+		if err := tr.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		for i, sn := range snaps {
+			if err := sn.s.tr.Validate(); err != nil {
+				t.Fatalf("%v: snapshot %v: %v", mode, i, err)
+			}
+			if !stringsEquals(snapshotKeys(sn.s), sn.keys) ||
+				sn.s.Len() != len(sn.keys) {
+				t.Fatalf("%v: snapshot %v changed", mode, i)
+			}
+		}
+	}
+}
+
+func TestReadSnapshotNoOps(t *testing.T) {
+	var tr BTree
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	tr.ReadSnapshot()
+	root := tr.root
+	// replacing a key and deleting a missing one leave shared nodes alone
+	allocs := testing.AllocsPerRun(100, func() {
+		tr.Set(keys[0])
+		tr.Delete("missing")
+	})
+	if allocs != 0 || tr.root != root {
+		t.Fatalf("expected no copies, got %v allocs", allocs)
+	}
+	// so an empty reserve doesn't stop TrySet from replacing
+	tr.Reserve(0)
+	if _, replaced, err := tr.TrySet(keys[1]); err != nil || !replaced {
+		t.Fatalf("expected a replace, got %v %v", replaced, err)
+	}
+	if _, _, err := tr.TrySet("missing"); err != ErrFull {
+		t.Fatalf("expected ErrFull, got %v", err)
+	}
+	if tr.root != root {
+		t.Fatal("expected no copies")
+	}
+}
+
+func TestReadSnapshotConcurrent(t *testing.T) {
+	var tr BTree
+	keys := randKeys(20_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	var cur atomic.Pointer[Snapshot]
+	cur.Store(tr.ReadSnapshot())
+	var done atomic.Bool
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !done.Load() {
+				s := cur.Load()
+				// every snapshot holds either all keys or all but one
+				n := 0
+				s.Scan(func(key string) bool {
+					n++
+					return true
+				})
+				if n != s.Len() || n < len(keys)-1 {
+					t.Errorf("expected %v keys, got %v", s.Len(), n)
+					return
+				}
+			}
+		}()
+	}
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	for i := 0; i < 2000; i++ {
+		key := keys[i%len(keys)]
+		tr.Delete(key)
+		cur.Store(tr.ReadSnapshot())
+		tr.Set(key)
+		cur.Store(tr.ReadSnapshot())
+	}
+	done.Store(true)
+	wg.Wait()
+	if !stringsEquals(snapshotKeys(cur.Load()), sorted) {
+		t.Fatal("mismatch")
+	}
+}
@@ -0,0 +1,162 @@
+package tinybtree
+
+import (
+	"encoding/json"
+	"unsafe"
+)
+
+// Stats holds structural information about a tree.
+type Stats struct {
+	// Height is the number of node levels, zero for an empty tree
+	Height int
+	// Len is the number of items in the tree
+	Len int
+	// Nodes is the number of nodes in the tree
+	Nodes int
+	// Leaves is the number of leaf nodes in the tree
+	Leaves int
+	// Fill is the average fraction of item slots in use per node
+	Fill float64
+	// Memory is the estimated number of bytes held by nodes and keys
+	Memory int
+	// Levels holds per level statistics, starting with the root
+	Levels []LevelStats
+	// Modifications is the number of operations that have changed the
+	// tree, where a range delete, Clear or rebuild counts as one
+	// and replacing a key with an equal one doesn't count
+	Modifications uint64
+}
+
+// LevelStats holds statistics for one level of a tree.
+type LevelStats struct {
+	// Nodes is the number of nodes on the level
+	Nodes int
+	// Items is the number of items held by nodes on the level
+	Items int
+	// Fill is the average fraction of item slots in use per node
+	Fill float64
+}
+
+// Stats returns structural information about the tree. It visits every
+// node, so it's O(n / maxItems).
+func (tr *BTree) Stats() Stats {
+	s := Stats{Modifications: tr.gen}
+	if tr.root == nil {
+		return s
+	}
+	s.Height = tr.Height()
+	s.Len = tr.length
+	s.Levels = make([]LevelStats, s.Height)
+	var keyBytes int
+	tr.root.stats(&s, &keyBytes, 0, tr.height)
+	for i := range s.Levels {
+		l := &s.Levels[i]
+		l.Fill = float64(l.Items) / float64(l.Nodes*maxItems)
+		s.Nodes += l.Nodes
+	}
+	s.Leaves = s.Levels[tr.height].Nodes
+	s.Fill = float64(s.Len) / float64(s.Nodes*maxItems)
+	s.Memory = s.Nodes*int(unsafe.Sizeof(node{})) +
+		(s.Nodes-s.Leaves)*int(unsafe.Sizeof([maxItems + 1]*node{})) +
+		keyBytes
+	return s
+}
+
+// Height returns the number of node levels in the tree, zero if it's empty
+func (tr *BTree) Height() int {
+	if tr.root == nil {
+		return 0
+	}
+	return tr.height + 1
+}
+
+// WalkLevels calls fn for each level of the tree, starting with the root,
+// with the number of nodes on the level and the items they hold in
+// ascending order. The items slice is reused between calls, and fn must not
+// modify the tree.
+func (tr *BTree) WalkLevels(fn func(level int, numNodes int, items []string)) {
+	if tr.root == nil {
+		return
+	}
+	var items []string
+	var next []*node
+	nodes := []*node{tr.root}
+	for level := 0; level <= tr.height; level++ {
+		items = items[:0]
+		next = next[:0]
+		for _, n := range nodes {
+			for i := 0; i < n.numItems; i++ {
+				items = append(items, n.items[i].key)
+			}
+			if level < tr.height {
+				next = append(next, n.children[:n.numItems+1]...)
+			}
+		}
+		fn(level, len(nodes), items)
+		nodes, next = next, nodes
+	}
+}
+
+func (n *node) stats(s *Stats, keyBytes *int, level, height int) {
+	s.Levels[level].Nodes++
+	s.Levels[level].Items += n.numItems
+	for i := 0; i < n.numItems; i++ {
+		*keyBytes += len(n.items[i].key)
+	}
+	if height > 0 {
+		for i := 0; i <= n.numItems; i++ {
+			n.children[i].stats(s, keyBytes, level+1, height-1)
+		}
+	}
+}
+
+// MarshalJSON encodes the stats using a stable schema, so it can be
+// embedded in health and monitoring endpoints.
+func (s Stats) MarshalJSON() ([]byte, error) {
+	type level struct {
+		Nodes int     `json:"nodes"`
+		Items int     `json:"items"`
+		Fill  float64 `json:"fill"`
+	}
+	levels := make([]level, len(s.Levels))
+	for i, l := range s.Levels {
+		levels[i] = level{l.Nodes, l.Items, l.Fill}
+	}
+	return json.Marshal(struct {
+		Height int     `json:"height"`
+		Len    int     `json:"len"`
+		Nodes  int     `json:"nodes"`
+		Leaves int     `json:"leaves"`
+		Fill   float64 `json:"fill"`
+		Memory int     `json:"memory"`
+		Levels []level `json:"levels"`
+		Mods   uint64  `json:"modifications"`
+	}{s.Height, s.Len, s.Nodes, s.Leaves, s.Fill, s.Memory, levels,
+		s.Modifications})
+}
+
+// Config describes the effective configuration of a tree.
+type Config struct {
+	// Degree is the maximum number of children per branch node
+	Degree int
+	// MaxItems is the maximum number of items per node, one less than
+	// Degree, as a node splits once it fills its item array
+	MaxItems int
+	// MinItems is the minimum number of items per non-root node
+	MinItems int
+	// Reserved is true when nodes are allocated from a reserve
+	Reserved bool
+	// Pooled is true when nodes are allocated from the node pool
+	Pooled bool
+}
+
+// Config returns the effective configuration of the tree.
+func (tr *BTree) Config() Config {
+	return Config{
+		Degree:   maxItems,
+		MaxItems: maxItems - 1,
+		MinItems: minItems,
+		Reserved: tr.reserved,
+		Pooled:   tr.pooled,
+	}
+}
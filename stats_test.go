@@ -0,0 +1,137 @@
+package tinybtree
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"testing"
+	"unsafe"
+)
+
+func TestStats(t *testing.T) {
+	var tr BTree
+	if s := tr.Stats(); s.Height != 0 || s.Nodes != 0 || s.Levels != nil {
+		t.Fatalf("expected zero stats, got %+v", s)
+	}
+	keys := randKeys(10_000)
+	for _, key := range keys {
+		tr.Set(key)
+	}
+	s := tr.Stats()
+	if s.Height != tr.height+1 {
+		t.Fatalf("expected %v, got %v", tr.height+1, s.Height)
+	}
+	if s.Len != len(keys) {
+		t.Fatalf("expected %v, got %v", len(keys), s.Len)
+	}
+	if s.Nodes < len(keys)/maxItems || s.Fill <= 0 || s.Fill > 1 {
+		t.Fatalf("bad stats %+v", s)
+	}
+	if len(s.Levels) != s.Height || s.Levels[0].Nodes != 1 ||
+		s.Leaves != s.Levels[s.Height-1].Nodes {
+		t.Fatalf("bad levels %+v", s.Levels)
+	}
+	var nodes, items int
+	for _, l := range s.Levels {
+		nodes += l.Nodes
+		items += l.Items
+	}
+	if nodes != s.Nodes || items != s.Len {
+		t.Fatalf("expected %v/%v, got %v/%v", s.Nodes, s.Len, nodes, items)
+	}
+	full := int(unsafe.Sizeof(node{}) + unsafe.Sizeof([maxItems + 1]*node{}))
+	if s.Memory >= s.Nodes*full {
+		t.Fatalf("leaves should not carry child arrays: %v bytes", s.Memory)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"height", "len", "nodes", "leaves", "fill",
+		"memory", "levels", "modifications"} {
+		if _, ok := m[name]; !ok {
+			t.Fatalf("missing '%v' in %s", name, data)
+		}
+	}
+	if m["modifications"] != float64(len(keys)) {
+		t.Fatalf("expected %v, got %v", len(keys), m["modifications"])
+	}
+	tr.Set(keys[0])
+	tr.Delete(keys[0])
+	tr.Delete(keys[0])
+	tr.Clear(false)
+	if n := tr.Stats().Modifications; n != uint64(len(keys))+2 {
+		t.Fatalf("expected %v, got %v", len(keys)+2, n)
+	}
+}
+
+func TestWalkLevels(t *testing.T) {
+	var tr BTree
+	if tr.Height() != 0 {
+		t.Fatalf("expected 0, got %v", tr.Height())
+	}
+	tr.WalkLevels(func(int, int, []string) {
+		t.Fatal("should not be reached")
+	})
+	for _, key := range randKeys(100_000) {
+		tr.Set(key)
+	}
+	s := tr.Stats()
+	if tr.Height() != s.Height || s.Height < 3 {
+		t.Fatalf("expected %v, got %v", s.Height, tr.Height())
+	}
+	var levels, items int
+	tr.WalkLevels(func(level, numNodes int, keys []string) {
+		if level != levels {
+			t.Fatalf("expected %v, got %v", levels, level)
+		}
+		l := s.Levels[level]
+		if numNodes != l.Nodes || len(keys) != l.Items {
+			t.Fatalf("expected %+v, got %v/%v", l, numNodes, len(keys))
+		}
+		if !sort.StringsAreSorted(keys) {
+			t.Fatalf("level %v out of order", level)
+		}
+		levels++
+		items += len(keys)
+	})
+	if levels != s.Height || items != tr.Len() {
+		t.Fatalf("expected %v/%v, got %v/%v", s.Height, tr.Len(), levels, items)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	var tr BTree
+	c := tr.Config()
+	if c.Degree != maxItems || c.MaxItems != maxItems-1 ||
+		c.MinItems != minItems || c.Reserved || c.Pooled {
+		t.Fatalf("bad config %+v", c)
+	}
+	// the builder fills every node but the last on each level, which
+	// reaches the reported limits
+	keys := randKeys(100_000)
+	sort.Strings(keys)
+	var b bytes.Buffer
+	for _, key := range keys {
+		b.WriteString(key + "\n")
+	}
+	full, err := LoadFromReader(&b, '\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := full.root.children[0]; n.numItems != c.MaxItems ||
+		n.numItems+1 != c.Degree {
+		t.Fatalf("expected %v items, got %v", c.MaxItems, n.numItems)
+	}
+	if err := full.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tr.UseNodePool(true)
+	if !tr.Config().Pooled {
+		t.Fatal("expected pooled")
+	}
+}
@@ -0,0 +1,354 @@
+package tinybtree
+
+// BTreeUint64 is an ordered set of uint64 keys. It has its own node type
+// holding the keys as integers, so comparisons are integer compares and
+// inserts don't allocate anything but nodes.
+type BTreeUint64 struct {
+	height int
+	root   *node64
+	length int
+	gen    uint64 // incremented on every modification
+}
+
+type node64 struct {
+	numItems int
+	items    [maxItems]uint64
+	children *[maxItems + 1]*node64 // nil for leaves
+}
+
+// guard wraps iter so that it panics if the tree is modified by iter and
+// iteration would continue.
+func (tr *BTreeUint64) guard(iter func(key uint64) bool) func(key uint64) bool {
+	gen := tr.gen
+	return func(key uint64) bool {
+		ok := iter(key)
+		if ok && tr.gen != gen {
+			panic(errModified)
+		}
+		return ok
+	}
+}
+
+func (n *node64) find(key uint64) (index int, found bool) {
+	low := 0
+	high := n.numItems
+	for low < high {
+		mid := int(uint(low+high) >> 1)
+		if n.items[mid] < key {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	return low, low < n.numItems && n.items[low] == key
+}
+
+// Set or replace a value for a key
+func (tr *BTreeUint64) Set(key uint64) (replaced bool) {
+	if tr.root == nil {
+		tr.root = new(node64)
+		tr.root.items[0] = key
+		tr.root.numItems = 1
+		tr.length = 1
+		tr.gen++
+		return false
+	}
+	replaced, split := tr.root.set(key, tr.height)
+	if replaced {
+		return true
+	}
+	if split {
+		left := tr.root
+		right, median := left.split(tr.height)
+		tr.root = &node64{children: new([maxItems + 1]*node64)}
+		tr.root.children[0] = left
+		tr.root.items[0] = median
+		tr.root.children[1] = right
+		tr.root.numItems = 1
+		tr.height++
+	}
+	tr.length++
+	tr.gen++
+	return false
+}
+
+// set inserts key into the subtree and reports whether n is now full.
+func (n *node64) set(key uint64, height int) (replaced, full bool) {
+	i, found := n.find(key)
+	if found {
+		return true, false
+	}
+	if height == 0 {
+		copy(n.items[i+1:n.numItems+1], n.items[i:n.numItems])
+		n.items[i] = key
+		n.numItems++
+		return false, n.numItems == maxItems
+	}
+	replaced, full = n.children[i].set(key, height-1)
+	if !full {
+		return replaced, false
+	}
+	right, median := n.children[i].split(height - 1)
+	copy(n.children[i+2:n.numItems+2], n.children[i+1:n.numItems+1])
+	copy(n.items[i+1:n.numItems+1], n.items[i:n.numItems])
+	n.items[i] = median
+	n.children[i+1] = right
+	n.numItems++
+	return false, n.numItems == maxItems
+}
+
+// split moves the upper half of a full node into a new right node and
+// returns it with the median item.
+func (n *node64) split(height int) (right *node64, median uint64) {
+	median = n.items[maxItems/2]
+	right = new(node64)
+	if height > 0 {
+		right.children = new([maxItems + 1]*node64)
+		copy(right.children[:maxItems/2+1], n.children[maxItems/2+1:])
+		for i := maxItems/2 + 1; i < maxItems+1; i++ {
+			n.children[i] = nil
+		}
+	}
+	copy(right.items[:maxItems/2], n.items[maxItems/2+1:])
+	right.numItems = maxItems / 2
+	n.numItems = maxItems / 2
+	return right, median
+}
+
+// Get a value for key
+func (tr *BTreeUint64) Get(key uint64) (gotten bool) {
+	n := tr.root
+	if n == nil {
+		return false
+	}
+	for height := tr.height; ; height-- {
+		i, found := n.find(key)
+		if found {
+			return true
+		}
+		if height == 0 {
+			return false
+		}
+		n = n.children[i]
+	}
+}
+
+// Delete a value for a key
+func (tr *BTreeUint64) Delete(key uint64) (deleted bool) {
+	if tr.root == nil {
+		return false
+	}
+	_, deleted = tr.root.delete(false, key, tr.height)
+	if !deleted {
+		return false
+	}
+	if tr.root.numItems == 0 {
+		if tr.height == 0 {
+			tr.root = nil
+		} else {
+			tr.root = tr.root.children[0]
+			tr.height--
+		}
+	}
+	tr.length--
+	tr.gen++
+	return true
+}
+
+// delete removes key, or the largest key when max is true, from the
+// subtree and returns it.
+func (n *node64) delete(max bool, key uint64, height int) (
+	prev uint64, deleted bool,
+) {
+	i, found := n.numItems-1, true
+	if !max {
+		i, found = n.find(key)
+	}
+	if height == 0 {
+		if !found {
+			return 0, false
+		}
+		prev = n.items[i]
+		copy(n.items[i:], n.items[i+1:n.numItems])
+		n.numItems--
+		return prev, true
+	}
+	switch {
+	case max:
+		i++
+		prev, deleted = n.children[i].delete(true, 0, height-1)
+	case found:
+		prev = n.items[i]
+		n.items[i], _ = n.children[i].delete(true, 0, height-1)
+		deleted = true
+	default:
+		prev, deleted = n.children[i].delete(false, key, height-1)
+	}
+	if deleted && n.children[i].numItems < minItems {
+		n.rebalance(i, height)
+	}
+	return prev, deleted
+}
+
+// rebalance refills the underfull child at index i by merging it with a
+// sibling or by moving one item over from it.
+func (n *node64) rebalance(i, height int) {
+	if i == n.numItems {
+		i--
+	}
+	left, right := n.children[i], n.children[i+1]
+	switch {
+	case left.numItems+right.numItems+1 < maxItems:
+		// merge left + item + right
+		left.items[left.numItems] = n.items[i]
+		copy(left.items[left.numItems+1:], right.items[:right.numItems])
+		if height > 1 {
+			copy(left.children[left.numItems+1:],
+				right.children[:right.numItems+1])
+		}
+		left.numItems += right.numItems + 1
+		copy(n.items[i:], n.items[i+1:n.numItems])
+		copy(n.children[i+1:], n.children[i+2:n.numItems+1])
+		n.children[n.numItems] = nil
+		n.numItems--
+	case left.numItems > right.numItems:
+		// move left -> right
+		copy(right.items[1:], right.items[:right.numItems])
+		right.items[0] = n.items[i]
+		n.items[i] = left.items[left.numItems-1]
+		if height > 1 {
+			copy(right.children[1:], right.children[:right.numItems+1])
+			right.children[0] = left.children[left.numItems]
+			left.children[left.numItems] = nil
+		}
+		right.numItems++
+		left.numItems--
+	default:
+		// move right -> left
+		left.items[left.numItems] = n.items[i]
+		n.items[i] = right.items[0]
+		copy(right.items[:], right.items[1:right.numItems])
+		if height > 1 {
+			left.children[left.numItems+1] = right.children[0]
+			copy(right.children[:], right.children[1:right.numItems+1])
+			right.children[right.numItems] = nil
+		}
+		left.numItems++
+		right.numItems--
+	}
+}
+
+// Len returns the number of items in the tree
+func (tr *BTreeUint64) Len() int {
+	return tr.length
+}
+
+// Min returns the smallest key in the tree
+func (tr *BTreeUint64) Min() (key uint64, gotten bool) {
+	if tr.root == nil {
+		return 0, false
+	}
+	n := tr.root
+	for height := tr.height; height > 0; height-- {
+		n = n.children[0]
+	}
+	return n.items[0], true
+}
+
+// Max returns the largest key in the tree
+func (tr *BTreeUint64) Max() (key uint64, gotten bool) {
+	if tr.root == nil {
+		return 0, false
+	}
+	n := tr.root
+	for height := tr.height; height > 0; height-- {
+		n = n.children[n.numItems]
+	}
+	return n.items[n.numItems-1], true
+}
+
+// Scan all items in tree
+func (tr *BTreeUint64) Scan(iter func(key uint64) bool) {
+	if tr.root != nil {
+		tr.root.scan(tr.guard(iter), tr.height)
+	}
+}
+
+func (n *node64) scan(iter func(key uint64) bool, height int) bool {
+	for i := 0; i < n.numItems; i++ {
+		if height > 0 && !n.children[i].scan(iter, height-1) {
+			return false
+		}
+		if !iter(n.items[i]) {
+			return false
+		}
+	}
+	return height == 0 || n.children[n.numItems].scan(iter, height-1)
+}
+
+func (n *node64) reverse(iter func(key uint64) bool, height int) bool {
+	for i := n.numItems - 1; i >= 0; i-- {
+		if height > 0 && !n.children[i+1].reverse(iter, height-1) {
+			return false
+		}
+		if !iter(n.items[i]) {
+			return false
+		}
+	}
+	return height == 0 || n.children[0].reverse(iter, height-1)
+}
+
+// Ascend the tree within the range [pivot, last]
+func (tr *BTreeUint64) Ascend(pivot uint64, iter func(key uint64) bool) {
+	if tr.root != nil {
+		tr.root.ascend(pivot, tr.guard(iter), tr.height)
+	}
+}
+
+func (n *node64) ascend(
+	pivot uint64, iter func(key uint64) bool, height int,
+) bool {
+	i, found := n.find(pivot)
+	if !found && height > 0 {
+		if !n.children[i].ascend(pivot, iter, height-1) {
+			return false
+		}
+	}
+	for ; i < n.numItems; i++ {
+		if !iter(n.items[i]) {
+			return false
+		}
+		if height > 0 && !n.children[i+1].scan(iter, height-1) {
+			return false
+		}
+	}
+	return true
+}
+
+// Descend the tree within the range [pivot, first]
+func (tr *BTreeUint64) Descend(pivot uint64, iter func(key uint64) bool) {
+	if tr.root != nil {
+		tr.root.descend(pivot, tr.guard(iter), tr.height)
+	}
+}
+
+func (n *node64) descend(
+	pivot uint64, iter func(key uint64) bool, height int,
+) bool {
+	i, found := n.find(pivot)
+	if !found {
+		if height > 0 && !n.children[i].descend(pivot, iter, height-1) {
+			return false
+		}
+		i--
+	}
+	for ; i >= 0; i-- {
+		if !iter(n.items[i]) {
+			return false
+		}
+		if height > 0 && !n.children[i].reverse(iter, height-1) {
+			return false
+		}
+	}
+	return true
+}
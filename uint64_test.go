@@ -0,0 +1,156 @@
+package tinybtree
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestBTreeUint64(t *testing.T) {
+	var tr BTreeUint64
+	if _, ok := tr.Min(); ok {
+		t.Fatal("expected false")
+	}
+	keys := make([]uint64, 10_000)
+	for i := range keys {
+		keys[i] = rand.Uint64()
+	}
+	keys[0], keys[1] = 0, 1<<64-1
+	for _, key := range keys {
+		if tr.Set(key) {
+			t.Fatal("expected false")
+		}
+	}
+	for _, key := range keys {
+		if !tr.Set(key) || !tr.Get(key) {
+			t.Fatal("expected true")
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	if min, _ := tr.Min(); min != 0 {
+		t.Fatalf("expected 0, got %v", min)
+	}
+	if max, _ := tr.Max(); max != 1<<64-1 {
+		t.Fatalf("expected %v, got %v", uint64(1<<64-1), max)
+	}
+	var i int
+	tr.Scan(func(key uint64) bool {
+		if key != keys[i] {
+			t.Fatalf("expected %v, got %v", keys[i], key)
+		}
+		i++
+		return true
+	})
+	pivot := keys[len(keys)/2]
+	var n int
+	tr.Ascend(pivot, func(key uint64) bool {
+		if key < pivot {
+			t.Fatal("out of range")
+		}
+		n++
+		return true
+	})
+	tr.Descend(pivot, func(key uint64) bool {
+		if key > pivot {
+			t.Fatal("out of range")
+		}
+		n++
+		return true
+	})
+	if n != len(keys)+1 {
+		t.Fatalf("expected %v, got %v", len(keys)+1, n)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		tr.Get(pivot)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected 0 allocs, got %v", allocs)
+	}
+	for _, key := range keys {
+		if !tr.Delete(key) {
+			t.Fatal("expected true")
+		}
+	}
+	if tr.Len() != 0 {
+		t.Fatalf("expected 0, got %v", tr.Len())
+	}
+}
+
+func (n *node64) check(t *testing.T, height int, root bool, min, max uint64) {
+	if !root && (n.numItems < minItems || n.numItems >= maxItems) {
+		t.Fatalf("bad fill %v", n.numItems)
+	}
+	for i := 0; i < n.numItems; i++ {
+		if n.items[i] < min || n.items[i] > max ||
+			(i > 0 && n.items[i] <= n.items[i-1]) {
+			t.Fatal("out of order")
+		}
+	}
+	if height > 0 {
+		for i := 0; i <= n.numItems; i++ {
+			lo, hi := min, max
+			if i > 0 {
+				lo = n.items[i-1] + 1
+			}
+			if i < n.numItems {
+				hi = n.items[i] - 1
+			}
+			n.children[i].check(t, height-1, false, lo, hi)
+		}
+	}
+}
+
+func TestBTreeUint64Churn(t *testing.T) {
+	var tr BTreeUint64
+	keys := make(map[uint64]bool)
+	for i := 0; i < 200_000; i++ {
+		key := uint64(rand.Intn(50_000))
+		if rand.Intn(3) == 0 {
+			if tr.Delete(key) != keys[key] {
+				t.Fatal("bad delete")
+			}
+			delete(keys, key)
+		} else {
+			if tr.Set(key) != keys[key] {
+				t.Fatal("bad set")
+			}
+			keys[key] = true
+		}
+	}
+	if tr.Len() != len(keys) {
+		t.Fatalf("expected %v, got %v", len(keys), tr.Len())
+	}
+	tr.root.check(t, tr.height, true, 0, 1<<64-1)
+	var prev uint64
+	var n int
+	tr.Scan(func(key uint64) bool {
+		if !keys[key] || (n > 0 && key <= prev) {
+			t.Fatalf("bad key %v", key)
+		}
+		prev = key
+		n++
+		return true
+	})
+	if n != len(keys) {
+		t.Fatalf("expected %v, got %v", len(keys), n)
+	}
+	// replacing and inserting into a leaf with room don't allocate
+	allocs := testing.AllocsPerRun(100, func() {
+		tr.Set(prev)
+		tr.Delete(prev)
+		tr.Set(prev)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected 0 allocs, got %v", allocs)
+	}
+	expectPanic(t, func() {
+		tr.Scan(func(key uint64) bool {
+			tr.Delete(key)
+			return true
+		})
+	})
+	tr.Scan(func(key uint64) bool {
+		tr.Delete(key)
+		return false
+	})
+}
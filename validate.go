@@ -0,0 +1,90 @@
+package tinybtree
+
+import "fmt"
+
+// Validate checks the invariants of the tree and returns an error that
+// describes the first violation found. It checks key ordering, the fill
+// of every node, that all leaves are at the same depth, subtree counts,
+// the tree length, and that no stale items or children remain in unused
+// slots. It visits every node, so it's O(n).
+func (tr *BTree) Validate() error {
+	if tr.root == nil {
+		if tr.length != 0 || tr.height != 0 {
+			return fmt.Errorf("tinybtree: empty tree has length %d and "+
+				"height %d", tr.length, tr.height)
+		}
+		return nil
+	}
+	if tr.height < 0 {
+		return fmt.Errorf("tinybtree: negative height %d", tr.height)
+	}
+	if err := tr.root.validate(tr.height, 0, "", "", false, false); err != nil {
+		return err
+	}
+	if tr.root.count != tr.length {
+		return fmt.Errorf("tinybtree: tree length is %d, but it holds %d "+
+			"items", tr.length, tr.root.count)
+	}
+	return nil
+}
+
+func (n *node) validate(
+	height, depth int, min, max string, hasMin, hasMax bool,
+) error {
+	if n.numItems < 1 || n.numItems >= maxItems ||
+		(depth > 0 && n.numItems < minItems) {
+		return fmt.Errorf("tinybtree: node at depth %d holds %d items",
+			depth, n.numItems)
+	}
+	for i := 0; i < n.numItems; i++ {
+		key := n.items[i].key
+		if (i > 0 && key <= n.items[i-1].key) ||
+			(hasMin && key <= min) || (hasMax && key >= max) {
+			return fmt.Errorf("tinybtree: key %q at depth %d is out of "+
+				"order", key, depth)
+		}
+	}
+	for i := n.numItems; i < maxItems; i++ {
+		if n.items[i] != (item{}) {
+			return fmt.Errorf("tinybtree: node at depth %d has a stale "+
+				"item in slot %d", depth, i)
+		}
+	}
+	last := -1
+	if height > 0 {
+		last = n.numItems
+		if n.children == nil {
+			return fmt.Errorf("tinybtree: branch at depth %d has no "+
+				"children", depth)
+		}
+		for i := 0; i <= maxItems; i++ {
+			if (i <= last) != (n.children[i] != nil) {
+				return fmt.Errorf("tinybtree: node at depth %d has a bad "+
+					"child in slot %d", depth, i)
+			}
+		}
+	} else if n.children != nil {
+		return fmt.Errorf("tinybtree: leaf at depth %d has children", depth)
+	}
+	count := n.numItems
+	for i := 0; i <= last; i++ {
+		lo, hi := min, max
+		hasLo, hasHi := hasMin, hasMax
+		if i > 0 {
+			lo, hasLo = n.items[i-1].key, true
+		}
+		if i < n.numItems {
+			hi, hasHi = n.items[i].key, true
+		}
+		err := n.children[i].validate(height-1, depth+1, lo, hi, hasLo, hasHi)
+		if err != nil {
+			return err
+		}
+		count += n.children[i].count
+	}
+	if n.count != count {
+		return fmt.Errorf("tinybtree: node at depth %d counts %d items, "+
+			"but its subtree holds %d", depth, n.count, count)
+	}
+	return nil
+}
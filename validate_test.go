@@ -0,0 +1,60 @@
+package tinybtree
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var tr BTree
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	keys := randKeys(100_000)
+	for i, key := range keys {
+		tr.Set(key)
+		if i%10_000 == 0 {
+			if err := tr.Validate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for i, key := range keys[:len(keys)*3/4] {
+		tr.Delete(key)
+		if i%10_000 == 0 {
+			if err := tr.Validate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tr.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	tr.WriteTo(&buf)
+	data := buf.Bytes()
+	tr2, err := Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr2.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// break each invariant in turn
+	corrupt := []func(tr *BTree){
+		func(tr *BTree) { tr.length++ },
+		func(tr *BTree) { tr.root.count-- },
+		func(tr *BTree) { tr.root.items[0].key = "~" },
+		func(tr *BTree) { tr.root.items[tr.root.numItems] = item{"x"} },
+		func(tr *BTree) { tr.root.children[0].numItems = 1 },
+		func(tr *BTree) { tr.height++ },
+	}
+	for i, fn := range corrupt {
+		tr2, _ = Load(bytes.NewReader(data))
+		fn(tr2)
+		if err := tr2.Validate(); err == nil {
+			t.Fatalf("corruption %d went undetected", i)
+		}
+	}
+}